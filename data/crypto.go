@@ -0,0 +1,266 @@
+package data
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPassphraseRequired = errors.New("budget is encrypted and needs its passphrase")
+	ErrWrongPassphrase    = errors.New("wrong passphrase")
+)
+
+const (
+	kdfName       = "pbkdf2-sha256"
+	kdfIterations = 600000
+	keyLength     = 32 // AES-256
+	saltLength    = 16
+
+	// The iteration counts accepted from a stored budget: fewer would make the
+	// passphrase cheap to guess, more would hang the app deriving the key
+	minKDFIterations = 100000
+	maxKDFIterations = 10000000
+)
+
+// budgetKey is the AES key derived from a budget's passphrase. It's kept with
+// the salt it was derived with so saves don't have to run the KDF again.
+type budgetKey struct {
+	salt       []byte
+	iterations int
+	key        []byte
+}
+
+type encryptionHeader struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// encryptedBudget is how an encrypted budget is stored. The name, dates and
+// revision stay readable so the budget list and conflict checks work while
+// the budget is locked; the wallets are only in the ciphertext.
+type encryptedBudget struct {
+	SchemaVersion int               `json:"schema_version"`
+	Name          string            `json:"name"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Revision      int64             `json:"revision"`
+	Encryption    *encryptionHeader `json:"encryption"`
+	Ciphertext    []byte            `json:"ciphertext"`
+}
+
+// newBudgetKey derives a key for a new passphrase with a fresh salt
+func newBudgetKey(passphrase string) (*budgetKey, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase can't be empty")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return deriveKey(passphrase, salt, kdfIterations)
+}
+
+func deriveKey(passphrase string, salt []byte, iterations int) (*budgetKey, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	return &budgetKey{salt: salt, iterations: iterations, key: key}, nil
+}
+
+func (k *budgetKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBudget wraps an encoded budget in an encrypted envelope
+func sealBudget(budgetFile *BudgetFile, plaintext []byte) ([]byte, error) {
+	aead, err := budgetFile.key.aead()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt budget '%s': %v", budgetFile.Name, err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to encrypt budget '%s': %v", budgetFile.Name, err)
+	}
+
+	envelope := encryptedBudget{
+		SchemaVersion: budgetFile.SchemaVersion,
+		Name:          budgetFile.Name,
+		CreatedAt:     budgetFile.CreatedAt,
+		UpdatedAt:     budgetFile.UpdatedAt,
+		Revision:      budgetFile.Revision,
+		Encryption: &encryptionHeader{
+			KDF:        kdfName,
+			Iterations: budgetFile.key.iterations,
+			Salt:       budgetFile.key.salt,
+			Nonce:      nonce,
+		},
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}
+
+	jsonData, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal budget file: %v", err)
+	}
+	return jsonData, nil
+}
+
+// parseEncryptedBudget returns the envelope of an encrypted budget, or nil
+// if content is a plain budget
+func parseEncryptedBudget(content []byte) (*encryptedBudget, error) {
+	var envelope encryptedBudget
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Encryption == nil {
+		return nil, nil
+	}
+	if envelope.Encryption.KDF != kdfName {
+		return nil, fmt.Errorf("unsupported key derivation '%s'", envelope.Encryption.KDF)
+	}
+	return &envelope, nil
+}
+
+// open decrypts the envelope with a key derived from its own salt
+func (e *encryptedBudget) open(key *budgetKey) ([]byte, error) {
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Encryption.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("budget '%s' has a damaged encryption header", e.Name)
+	}
+
+	plaintext, err := aead.Open(nil, e.Encryption.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// matches reports whether key was derived for this envelope's salt
+func (e *encryptedBudget) matches(key *budgetKey) bool {
+	return key != nil && bytes.Equal(key.salt, e.Encryption.Salt)
+}
+
+// lockedBudget returns what can be known about the budget without its passphrase
+func (e *encryptedBudget) lockedBudget(slug string) *BudgetFile {
+	return &BudgetFile{
+		SchemaVersion: e.SchemaVersion,
+		Slug:          slug,
+		Name:          e.Name,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		Revision:      e.Revision,
+		Encrypted:     true,
+	}
+}
+
+// unlockBudget derives the key of an encrypted budget and checks it by decrypting
+func unlockBudget(content []byte, passphrase string) (*budgetKey, error) {
+	envelope, err := parseEncryptedBudget(content)
+	if err != nil {
+		return nil, err
+	}
+	if envelope == nil {
+		return nil, fmt.Errorf("budget is not encrypted")
+	}
+	if iterations := envelope.Encryption.Iterations; iterations < minKDFIterations || iterations > maxKDFIterations {
+		return nil, fmt.Errorf("budget '%s' asks for %d key derivation iterations, only %d to %d are accepted", envelope.Name, iterations, minKDFIterations, maxKDFIterations)
+	}
+
+	key, err := deriveKey(passphrase, envelope.Encryption.Salt, envelope.Encryption.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := envelope.open(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// requireUnlocked refuses to hand out a budget whose wallets couldn't be decrypted
+func requireUnlocked(budgetFile *BudgetFile) (*BudgetFile, error) {
+	if budgetFile.Locked() {
+		return nil, fmt.Errorf("budget '%s': %w", budgetFile.Name, ErrPassphraseRequired)
+	}
+	return budgetFile, nil
+}
+
+// keyring remembers the keys of budgets unlocked during this session, by slug
+type keyring struct {
+	mu   sync.Mutex
+	keys map[string]*budgetKey
+}
+
+func (k *keyring) get(slug string) *budgetKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys[slug]
+}
+
+func (k *keyring) set(slug string, key *budgetKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		k.keys = make(map[string]*budgetKey)
+	}
+	k.keys[slug] = key
+}
+
+func (k *keyring) forget(slug string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, slug)
+}
+
+// remember keeps the key of a budget that was just saved, so it can be
+// loaded again without asking for the passphrase
+func (k *keyring) remember(budgetFile *BudgetFile) {
+	if budgetFile.Encrypted && budgetFile.key != nil {
+		k.set(budgetFile.Slug, budgetFile.key)
+	} else {
+		k.forget(budgetFile.Slug)
+	}
+}
+
+// EncryptBudget stores the budget encrypted with a key derived from passphrase.
+// Calling it on an encrypted budget changes its passphrase.
+func EncryptBudget(s Store, data *BudgetFile, passphrase string) error {
+	key, err := newBudgetKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	data.Encrypted = true
+	data.key = key
+	return s.Save(data)
+}
+
+// DecryptBudget stores an encrypted budget as plain JSON again
+func DecryptBudget(s Store, data *BudgetFile) error {
+	if !data.Encrypted {
+		return fmt.Errorf("budget '%s' is not encrypted", data.Name)
+	}
+
+	data.Encrypted = false
+	data.key = nil
+	return s.Save(data)
+}
@@ -3,175 +3,283 @@ package data
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type FrankfurterResponse struct {
-	Amount float64            `json:"amount"`
-	Base   string             `json:"base"`
-	Date   string             `json:"date"`
-	Rates  map[string]float64 `json:"rates"`
-}
-
-type OpenERResponse struct {
-	Disclaimer string             `json:"disclaimer"`
-	License    string             `json:"license"`
-	Timestamp  int64              `json:"timestamp"`
-	Base       string             `json:"base"`
-	Rates      map[string]float64 `json:"rates"`
+// RateTable holds the rates quoted against one base currency on one day
+type RateTable struct {
+	Base      string             `json:"base"`
+	Date      string             `json:"date"` // YYYY-MM-DD
+	Rates     map[string]float64 `json:"rates"`
+	Timestamp int64              `json:"timestamp"`
+	TTL       int64              `json:"ttl"` // seconds the rates stay fresh
 }
 
+// ExchangeRateCache keeps rate tables keyed by base and date, see rateKey
 type ExchangeRateCache struct {
-	Rates     map[string]float64 `json:"rates"`
-	Base      string             `json:"base"`
-	Timestamp int64              `json:"timestamp"`
-	TTL       int64              `json:"ttl"`
+	Tables map[string]RateTable `json:"tables"`
 }
 
+// defaultCacheTTL is how long fetched rates stay fresh unless cache_ttl says otherwise
+const defaultCacheTTL = 3600
+
 type CurrencyConfig struct {
-	PrimaryAPI  string `json:"primary_api"`
-	BackupAPI   string `json:"backup_api"`
-	CacheTTL    int64  `json:"cache_ttl"`
+	PrimaryAPI  string `json:"primary_api"` // base URL of the Frankfurter API
+	BackupAPI   string `json:"backup_api"`  // base URL of the Open ER API
+	CacheTTL    int64  `json:"cache_ttl"`   // seconds, defaults to an hour
 	DefaultBase string `json:"default_base"`
+
+	// Providers lists where rates come from, tried in order: "frankfurter",
+	// "open-er" and "file". Defaults to both APIs, then the rates file if set.
+	Providers []string `json:"providers,omitempty"`
+	RatesFile string   `json:"rates_file,omitempty"`
+	// Timeout in seconds for each request to a rate API
+	Timeout int `json:"timeout,omitempty"`
+	// Offline never fetches rates and converts with the cached ones however
+	// old; the --offline flag turns it on too
+	Offline bool `json:"offline,omitempty"`
 }
 
-func fetchFromFrankfurter(baseCurrency string) (*FrankfurterResponse, error) {
-	url := fmt.Sprintf("https://api.frankfurter.dev/v1/latest?base=%s", baseCurrency)
+func getCachePath() string {
+	return filepath.Join(CurrentPaths().CacheDir, "exchange_cache.json")
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch from Frankfurter: %v", err)
+// loadCache reads a file of rate tables, the cache or the rate history
+func loadCache(cachePath string) (*ExchangeRateCache, error) {
+	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
+		return nil, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Frankfurter API returned status %d", resp.StatusCode)
+	file, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
 	}
 
-	var frankResp FrankfurterResponse
-	err = json.NewDecoder(resp.Body).Decode(&frankResp)
+	var cache ExchangeRateCache
+	err = json.Unmarshal(file, &cache)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode Frankfurter response: %v", err)
+		return nil, err
 	}
 
-	return &frankResp, nil
+	return &cache, nil
 }
 
-func fetchFromOpenER(baseCurrency string) (*OpenERResponse, error) {
-	url := fmt.Sprintf("https://open.er-api.com/v6/latest/%s", baseCurrency)
+func saveCache(cachePath string, cache *ExchangeRateCache) error {
+	dir := filepath.Dir(cachePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
-	resp, err := http.Get(url)
+	jsonData, err := json.MarshalIndent(cache, "", " ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch from Open ER: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Open ER API returned status %d", resp.StatusCode)
+	return writeFileAtomic(cachePath, jsonData, 0644)
+}
+
+func rateKey(base, date string) string {
+	return base + "@" + date
+}
+
+func cacheTTL() int64 {
+	if config.Currency.CacheTTL > 0 {
+		return config.Currency.CacheTTL
 	}
+	return defaultCacheTTL
+}
 
-	var openResp OpenERResponse
-	err = json.NewDecoder(resp.Body).Decode(&openResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode Open ER response: %v", err)
+// Fresh reports whether the rates are still within their TTL
+func (t RateTable) Fresh() bool {
+	return time.Now().Unix()-t.Timestamp < t.TTL
+}
+
+// AsOf returns when the rates were fetched
+func (t RateTable) AsOf() time.Time {
+	return time.Unix(t.Timestamp, 0)
+}
+
+// rebaseRates turns rates quoted against tableBase into rates quoted against
+// another currency in the table: one unit of base buys rates[x] / rates[base] of x
+func rebaseRates(rates map[string]float64, tableBase, base string) (map[string]float64, bool) {
+	if tableBase == base {
+		return rates, true
+	}
+	baseRate, ok := rates[base]
+	if !ok || baseRate <= 0 {
+		return nil, false
 	}
 
-	return &openResp, nil
+	rebased := map[string]float64{tableBase: 1 / baseRate}
+	for currency, rate := range rates {
+		if currency != base {
+			rebased[currency] = rate / baseRate
+		}
+	}
+	return rebased, true
 }
 
-func fetchExchangeRates(baseCurrency string) (map[string]float64, error) {
-	baseCurrency, err := normalizeCurrency(baseCurrency)
-	if err != nil {
-		return nil, err // Add this check
+// latestTable returns the newest table that quotes base, whatever that
+// table's own base. With freshOnly, tables past their TTL are skipped.
+func (c *ExchangeRateCache) latestTable(base string, freshOnly bool) (RateTable, bool) {
+	var newest *RateTable
+	for _, table := range c.Tables {
+		if freshOnly && !table.Fresh() {
+			continue
+		}
+		if _, quoted := table.Rates[base]; table.Base != base && !quoted {
+			continue
+		}
+		// Prefer a table in the requested base when both are as new
+		if newest == nil || table.Timestamp > newest.Timestamp ||
+			(table.Timestamp == newest.Timestamp && table.Base == base) {
+			newest = &table
+		}
 	}
+	if newest == nil {
+		return RateTable{}, false
+	}
+	return *newest, true
+}
 
-	frankResp, err := fetchFromFrankfurter(baseCurrency)
-	if err == nil {
-		return frankResp.Rates, nil
+// cachedRates returns rates against base from the newest table quoting it
+func (c *ExchangeRateCache) cachedRates(base string, freshOnly bool) (map[string]float64, bool) {
+	table, ok := c.latestTable(base, freshOnly)
+	if !ok {
+		return nil, false
 	}
+	return rebaseRates(table.Rates, table.Base, base)
+}
 
-	openResp, err := fetchFromOpenER(baseCurrency)
-	if err == nil {
-		return openResp.Rates, nil
+// store adds a table, replacing older days of the same base
+func (c *ExchangeRateCache) store(table RateTable) {
+	if c.Tables == nil {
+		c.Tables = make(map[string]RateTable)
+	}
+	for key, cached := range c.Tables {
+		if cached.Base == table.Base && cached.Date < table.Date {
+			delete(c.Tables, key)
+		}
 	}
+	c.Tables[rateKey(table.Base, table.Date)] = table
+}
 
-	return nil, fmt.Errorf("both APIs failed: %v", err)
+// retryAfter is how long a failed fetch keeps us on cached rates before the
+// providers are asked again, so a dead network doesn't stall every conversion
+const retryAfter = 5 * time.Minute
+
+var fetchFailures struct {
+	mu     sync.Mutex
+	byBase map[string]fetchFailure
 }
 
-func getCachePath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".budget", "exchange_cache.json")
+type fetchFailure struct {
+	at  time.Time
+	err error
 }
 
-func loadCache() (*ExchangeRateCache, error) {
-	cachePath := getCachePath()
+// offline stops rates being fetched; conversions then use cached rates however old
+var offline atomic.Bool
 
-	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
-		return nil, nil
-	}
+// SetOffline turns offline mode on or off
+func SetOffline(on bool) {
+	offline.Store(on)
+}
 
-	file, err := os.ReadFile(cachePath)
-	if err != nil {
-		return nil, err
-	}
+// IsOffline reports whether rates are only taken from the cache
+func IsOffline() bool {
+	return offline.Load()
+}
 
-	var cache ExchangeRateCache
-	err = json.Unmarshal(file, &cache)
+// RatesAsOf returns the newest cached rate table quoting base, so callers can
+// tell how old the rates behind a conversion are
+func RatesAsOf(base string) (RateTable, bool) {
+	base, err := normalizeCurrency(base)
 	if err != nil {
-		return nil, err
+		return RateTable{}, false
 	}
-
-	return &cache, nil
+	cache, err := loadCache(getCachePath())
+	if err != nil || cache == nil {
+		return RateTable{}, false
+	}
+	return cache.latestTable(base, false)
 }
 
-func saveCache(cache *ExchangeRateCache) error {
-	cachePath := getCachePath()
-	dir := filepath.Dir(cachePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+// fetchRates calls fetch unless it failed for the same key, a base or a base
+// and day, within retryAfter
+func fetchRates(key string, fetch func() (map[string]float64, error)) (map[string]float64, error) {
+	fetchFailures.mu.Lock()
+	failure, failed := fetchFailures.byBase[key]
+	fetchFailures.mu.Unlock()
+	if failed && time.Since(failure.at) < retryAfter {
+		return nil, failure.err
 	}
 
-	jsonData, err := json.MarshalIndent(cache, "", " ")
+	rates, err := fetch()
+
+	fetchFailures.mu.Lock()
+	defer fetchFailures.mu.Unlock()
 	if err != nil {
-		return err
+		if fetchFailures.byBase == nil {
+			fetchFailures.byBase = make(map[string]fetchFailure)
+		}
+		fetchFailures.byBase[key] = fetchFailure{at: time.Now(), err: err}
+		return nil, err
 	}
-
-	return os.WriteFile(cachePath, jsonData, 0644)
+	delete(fetchFailures.byBase, key)
+	return rates, nil
 }
 
-func isCacheValid(cache *ExchangeRateCache) bool {
-	if cache == nil {
-		return false
+// getExchangeRates returns rates against baseCurrency: cached ones while they
+// are fresh, else newly fetched ones, else the last cached ones however old.
+// Without fetch only the cache is used, as when offline.
+func getExchangeRates(baseCurrency string, fetch bool) (map[string]float64, error) {
+	cache, err := loadCache(getCachePath())
+	if err != nil || cache == nil {
+		cache = &ExchangeRateCache{}
+	}
+	if rates, ok := cache.cachedRates(baseCurrency, true); ok {
+		return rates, nil
 	}
 
-	now := time.Now().Unix()
-	return now-cache.Timestamp < cache.TTL
-}
-
-func getExchangeRates(baseCurrency string) (map[string]float64, error) {
-	cache, err := loadCache()
-	if err == nil && cache != nil && cache.Base == baseCurrency && isCacheValid(cache) {
-		return cache.Rates, nil
+	if IsOffline() || !fetch {
+		if rates, ok := cache.cachedRates(baseCurrency, false); ok {
+			return rates, nil
+		}
+		if !fetch {
+			return nil, fmt.Errorf("no cached rates for %s", baseCurrency)
+		}
+		return nil, fmt.Errorf("offline, and no cached rates for %s", baseCurrency)
 	}
 
-	rates, err := fetchExchangeRates(baseCurrency)
+	rates, err := fetchRates(baseCurrency, func() (map[string]float64, error) {
+		return currentRateProvider().Rates(baseCurrency)
+	})
 	if err != nil {
+		if stale, ok := cache.cachedRates(baseCurrency, false); ok {
+			return stale, nil
+		}
 		return nil, err
 	}
 
-	newCache := &ExchangeRateCache{
-		Rates:     rates,
+	now := time.Now()
+	cache.store(RateTable{
 		Base:      baseCurrency,
-		Timestamp: time.Now().Unix(),
-		TTL:       3600,
+		Date:      now.Format(dateLayout),
+		Rates:     rates,
+		Timestamp: now.Unix(),
+		TTL:       cacheTTL(),
+	})
+	if err := saveCache(getCachePath(), cache); err != nil {
+		log.Printf("failed to save exchange rate cache: %v", err)
 	}
 
-	saveCache(newCache)
-
 	return rates, nil
 }
 
@@ -191,7 +299,101 @@ func normalizeCurrency(currency string) (string, error) {
 	return normalized, nil
 }
 
-func ConvertCurrency(amount float64, fromCurrency, toCurrency, baseCurrency string) (float64, error) {
+// ConvertCurrency converts an amount at today's rates, or at the rates of the
+// day given, see ExchangeRate
+func ConvertCurrency(amount Money, fromCurrency, toCurrency, baseCurrency string, overrides RateOverrides, on ...time.Time) (Money, error) {
+	var day time.Time
+	if len(on) > 0 {
+		day = on[0]
+	}
+	return convert(amount, fromCurrency, toCurrency, baseCurrency, overrides, day, true)
+}
+
+// convert is ConvertCurrency; without fetch it only uses stored rates and
+// never goes to the network
+func convert(amount Money, fromCurrency, toCurrency, baseCurrency string, overrides RateOverrides, day time.Time, fetch bool) (Money, error) {
+	rate, err := exchangeRate(fromCurrency, toCurrency, baseCurrency, overrides, day, fetch)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return amount.MulRate(rate, CurrencyExponent(toCurrency))
+}
+
+// ExchangeRate returns how many units of toCurrency one unit of fromCurrency
+// buys, using rates quoted against baseCurrency. Either side may be a crypto,
+// commodity or custom unit, which is first valued in fiat, see unitQuote.
+// The budget's overrides, if any, are consulted before the rate providers,
+// see RateOverrides.resolve.
+//
+// An optional past day uses that day's fiat rates from the rate history.
+// Overrides and the quotes of non-fiat units are not dated and apply as they
+// are today.
+func ExchangeRate(fromCurrency, toCurrency, baseCurrency string, overrides RateOverrides, on ...time.Time) (float64, error) {
+	var day time.Time
+	if len(on) > 0 {
+		day = on[0]
+	}
+	return exchangeRate(fromCurrency, toCurrency, baseCurrency, overrides, day, true)
+}
+
+// exchangeRate is ExchangeRate; without fetch it only uses stored rates
+func exchangeRate(fromCurrency, toCurrency, baseCurrency string, overrides RateOverrides, day time.Time, fetch bool) (float64, error) {
+	from, err := LookupUnit(fromCurrency)
+	if err != nil {
+		return 0, err
+	}
+	to, err := LookupUnit(toCurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	rate, _, err := overrides.resolve(from.Code, to.Code, baseCurrency, day, fetch)
+	return rate, err
+}
+
+// marketRate is exchangeRate from the rate providers alone
+func marketRate(fromCurrency, toCurrency, baseCurrency string, day time.Time, fetch bool) (float64, error) {
+	from, err := LookupUnit(fromCurrency)
+	if err != nil {
+		return 0, err
+	}
+	to, err := LookupUnit(toCurrency)
+	if err != nil {
+		return 0, err
+	}
+	if from.Code == to.Code {
+		return 1, nil
+	}
+
+	fromValue, fromFiat := 1.0, from.Code
+	if from.Kind != UnitFiat {
+		if fromValue, fromFiat, err = unitQuote(from); err != nil {
+			return 0, err
+		}
+	}
+	toValue, toFiat := 1.0, to.Code
+	if to.Kind != UnitFiat {
+		if toValue, toFiat, err = unitQuote(to); err != nil {
+			return 0, err
+		}
+	}
+
+	// The APIs only quote against fiat currencies
+	if base, err := LookupUnit(baseCurrency); err != nil || base.Kind != UnitFiat {
+		baseCurrency = fromFiat
+	}
+
+	rate, err := fiatRate(fromFiat, toFiat, baseCurrency, day, fetch)
+	if err != nil {
+		return 0, err
+	}
+	return fromValue * rate / toValue, nil
+}
+
+// fiatRate is ExchangeRate between two fiat currencies, at the latest rates
+// unless day is in the past
+func fiatRate(fromCurrency, toCurrency, baseCurrency string, day time.Time, fetch bool) (float64, error) {
 	fromCurrency, err := normalizeCurrency(fromCurrency)
 	if err != nil {
 		return 0, err
@@ -206,34 +408,37 @@ func ConvertCurrency(amount float64, fromCurrency, toCurrency, baseCurrency stri
 	}
 
 	if fromCurrency == toCurrency {
-		return amount, nil
+		return 1, nil
 	}
 
-	rates, err := getExchangeRates(baseCurrency)
+	var rates map[string]float64
+	if isPastDay(day) {
+		rates, err = historicalRates(baseCurrency, day, fetch)
+	} else {
+		rates, err = getExchangeRates(baseCurrency, fetch)
+	}
 	if err != nil {
 		return 0, err
 	}
 
-	var baseAmount float64
-	if fromCurrency == baseCurrency {
-		baseAmount = amount
-	} else {
-		fromRate, exists := rates[fromCurrency]
+	// Rates are quoted per unit of base currency, so the cross rate is toRate / fromRate
+	fromRate := 1.0
+	if fromCurrency != baseCurrency {
+		rate, exists := rates[fromCurrency]
 		if !exists {
 			return 0, fmt.Errorf("no exchange rate found for %s", fromCurrency)
 		}
-		baseAmount = amount / fromRate
-	}
-
-	if toCurrency == baseCurrency {
-		return baseAmount, nil
+		fromRate = rate
 	}
 
-	toRate, exists := rates[toCurrency]
-	if !exists {
-		return 0, fmt.Errorf("no exchange rate found for %s", toCurrency)
+	toRate := 1.0
+	if toCurrency != baseCurrency {
+		rate, exists := rates[toCurrency]
+		if !exists {
+			return 0, fmt.Errorf("no exchange rate found for %s", toCurrency)
+		}
+		toRate = rate
 	}
 
-	return baseAmount * toRate, nil
-
+	return toRate / fromRate, nil
 }
@@ -0,0 +1,339 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirStore keeps each budget as a JSON file named after its slug in a directory
+type DirStore struct {
+	dir  string
+	keys keyring
+}
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+// path returns the file a budget is stored in, refusing slugs that would
+// point outside the store's directory
+func (s *DirStore) path(slug, ext string) (string, error) {
+	if err := checkSlug(slug); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, slug+ext), nil
+}
+
+func (s *DirStore) ensureDir() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create budgets directory: %v", err)
+	}
+	return nil
+}
+
+func (s *DirStore) List() ([]BudgetFile, error) {
+	// Create directory if it doesn't exist
+	if err := s.ensureDir(); err != nil {
+		return nil, err
+	}
+
+	// Read directory contents
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budgets directory: %v", err)
+	}
+
+	var budgetFiles []BudgetFile
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
+			slug := strings.TrimSuffix(file.Name(), ".json")
+			budgetFile, err := s.load(slug)
+			if err != nil {
+				// Skip files that can't be loaded
+				log.Printf("skipping budget file '%s': %v", file.Name(), err)
+				continue
+			}
+			budgetFiles = append(budgetFiles, *budgetFile)
+		}
+	}
+
+	sortByUpdated(budgetFiles)
+
+	return budgetFiles, nil
+}
+
+func (s *DirStore) Load(slug string) (*BudgetFile, error) {
+	budgetFile, err := s.load(slug)
+	if err != nil {
+		return nil, err
+	}
+	return requireUnlocked(budgetFile)
+}
+
+// load reads a budget, returning encrypted budgets that weren't unlocked as Locked
+func (s *DirStore) load(slug string) (*BudgetFile, error) {
+	filePath, err := s.path(slug, ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("budget file '%s' does not exist", slug)
+	}
+
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget file '%s': %v", slug, err)
+	}
+
+	budgetFile, fromVersion, needsSave, err := loadBudget(file, slug, s.keys.get(slug))
+	if err != nil {
+		return nil, err
+	}
+	if budgetFile.Locked() {
+		return budgetFile, nil
+	}
+
+	// Persist right away so migrated values and wallet IDs are stable across
+	// loads, but only with the budget's lock: listing budgets or opening one
+	// read-only must not write, and would race the process that has it open.
+	// Without the lock the upgraded copy stays in memory.
+	if needsSave && s.holdsLock(slug) {
+		if fromVersion < CurrentSchemaVersion {
+			if err := backupBudgetFile(filePath, file, fromVersion); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.Save(budgetFile); err != nil {
+			log.Printf("budget '%s': failed to save upgraded file: %v", slug, err)
+		}
+	}
+
+	return budgetFile, nil
+}
+
+func (s *DirStore) Create(name string) (*BudgetFile, error) {
+	budgetFile, err := newBudgetFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create directory if it doesn't exist
+	if err := s.ensureDir(); err != nil {
+		return nil, err
+	}
+
+	// Check if file already exists
+	if err := s.checkFree(budgetFile.Slug); err != nil {
+		return nil, err
+	}
+
+	if err := s.write(budgetFile); err != nil {
+		return nil, err
+	}
+
+	return budgetFile, nil
+}
+
+// checkFree fails if a budget is already stored under slug
+func (s *DirStore) checkFree(slug string) error {
+	filePath, err := s.path(slug, ".json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filePath); err == nil {
+		return fmt.Errorf("a budget is already stored as '%s'", slug)
+	}
+	return nil
+}
+
+func (s *DirStore) Save(budgetFile *BudgetFile) error {
+	return s.save(budgetFile, false)
+}
+
+func (s *DirStore) ForceSave(budgetFile *BudgetFile) error {
+	return s.save(budgetFile, true)
+}
+
+func (s *DirStore) save(budgetFile *BudgetFile, force bool) error {
+	// Create directory if it doesn't exist
+	if err := s.ensureDir(); err != nil {
+		return err
+	}
+
+	diskRevision, diskVersion, err := s.readDiskRevision(budgetFile.Slug)
+	if err != nil && !force {
+		return fmt.Errorf("failed to check budget file '%s' before saving: %v", budgetFile.Slug, err)
+	}
+	if err := prepareSave(budgetFile, diskRevision, diskVersion, force); err != nil {
+		return err
+	}
+
+	return s.write(budgetFile)
+}
+
+func (s *DirStore) write(budgetFile *BudgetFile) error {
+	filePath, err := s.path(budgetFile.Slug, ".json")
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := encodeBudgetFile(budgetFile)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filePath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write budget file '%s': %v", budgetFile.Slug, err)
+	}
+	s.keys.remember(budgetFile)
+
+	if budgetFile.Encrypted {
+		s.removePlainBackups(budgetFile.Slug)
+	}
+
+	return nil
+}
+
+// removePlainBackups deletes migration backups of a budget that was since
+// encrypted, so no readable copy of it is left behind
+func (s *DirStore) removePlainBackups(slug string) {
+	backups, _ := filepath.Glob(filepath.Join(s.dir, slug+".json.v*.bak"))
+	for _, backup := range backups {
+		content, err := os.ReadFile(backup)
+		if err != nil {
+			continue
+		}
+		if envelope, err := parseEncryptedBudget(content); err == nil && envelope != nil {
+			continue
+		}
+		if err := os.Remove(backup); err != nil {
+			log.Printf("budget '%s': failed to remove unencrypted backup %s: %v", slug, backup, err)
+			continue
+		}
+		log.Printf("budget '%s': removed unencrypted backup %s", slug, backup)
+	}
+}
+
+// readDiskRevision returns the revision and schema version of the budget
+// currently on disk, or zeros if there is none
+func (s *DirStore) readDiskRevision(slug string) (int64, int, error) {
+	filePath, err := s.path(slug, ".json")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	file, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return readRevision(file)
+}
+
+func (s *DirStore) Delete(slug string) error {
+	filePath, err := s.path(slug, ".json")
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return fmt.Errorf("budget file '%s' does not exist", slug)
+	}
+
+	// Refuse to delete a budget another process has open
+	lock, err := s.Lock(slug)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := os.Remove(filePath); err != nil {
+		return fmt.Errorf("failed to delete budget file '%s': %v", slug, err)
+	}
+	s.keys.forget(slug)
+
+	return nil
+}
+
+func (s *DirStore) Rename(slug, newName string) error {
+	if err := ValidateBudgetName(newName); err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	newSlug := Slugify(newName)
+
+	if newSlug != slug {
+		if err := s.checkFree(newSlug); err != nil {
+			return err
+		}
+	}
+
+	// Refuse to rename a budget another process has open
+	lock, err := s.Lock(slug)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	budgetFile, err := s.Load(slug)
+	if err != nil {
+		return err
+	}
+
+	budgetFile.Name = newName
+	budgetFile.Slug = newSlug
+	if err := s.Save(budgetFile); err != nil {
+		return err
+	}
+
+	if newSlug != slug {
+		oldPath, _ := s.path(slug, ".json")
+		if err := os.Remove(oldPath); err != nil {
+			return fmt.Errorf("failed to remove old budget file '%s': %v", slug, err)
+		}
+		s.keys.forget(slug)
+	}
+
+	return nil
+}
+
+func (s *DirStore) Unlock(slug, passphrase string) error {
+	filePath, err := s.path(slug, ".json")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read budget file '%s': %v", slug, err)
+	}
+
+	key, err := unlockBudget(file, passphrase)
+	if err != nil {
+		return err
+	}
+	s.keys.set(slug, key)
+
+	return nil
+}
+
+// Lock takes the advisory lock file for a budget
+func (s *DirStore) Lock(slug string) (*BudgetLock, error) {
+	lockPath, err := s.path(slug, ".lock")
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(lockPath, slug)
+}
+
+// holdsLock reports whether this process has the budget locked
+func (s *DirStore) holdsLock(slug string) bool {
+	lockPath, err := s.path(slug, ".lock")
+	return err == nil && heldHere(lockPath)
+}
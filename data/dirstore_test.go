@@ -0,0 +1,212 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadWithoutLockDoesNotWrite(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	dir := t.TempDir()
+	legacy := []byte(`{"wallets": [{"name": "Cash", "currency": "USD", "balance": 12.5}], "default_currency": "USD"}`)
+	filePath := filepath.Join(dir, "home.json")
+	if err := os.WriteFile(filePath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewDirStore(dir)
+	if _, err := s.List(); err != nil {
+		t.Fatal(err)
+	}
+	budget, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.SchemaVersion != CurrentSchemaVersion || budget.Wallets[0].ID == "" {
+		t.Errorf("budget not upgraded in memory")
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, legacy) {
+		t.Errorf("loading without the lock rewrote the file")
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, "*.bak")); len(backups) > 0 {
+		t.Errorf("loading without the lock wrote backups %v", backups)
+	}
+}
+
+func TestLoadWithOtherProcessLockDoesNotWrite(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	dir := t.TempDir()
+	legacy := []byte(`{"wallets": [{"name": "Cash", "currency": "USD", "balance": 12.5}], "default_currency": "USD"}`)
+	filePath := filepath.Join(dir, "home.json")
+	if err := os.WriteFile(filePath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The parent process stands in for another instance of the app
+	hostname, _ := os.Hostname()
+	owner := []byte(strconv.Itoa(os.Getppid()) + "\n" + hostname + "\n")
+	if err := os.WriteFile(filepath.Join(dir, "home.lock"), owner, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDirStore(dir).Load("home"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(filePath)
+	if !bytes.Equal(content, legacy) {
+		t.Errorf("loading while another process holds the lock rewrote the file")
+	}
+}
+
+func TestSaveStaleRevision(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	s := NewDirStore(t.TempDir())
+	if _, err := s.Create("Home"); err != nil {
+		t.Fatal(err)
+	}
+	ours, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theirs.DefaultCurrency = "EUR"
+	if err := s.Save(theirs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our copy is a revision behind, so saving it would lose their change
+	ours.DefaultCurrency = "GBP"
+	var conflict *ConflictError
+	if err := s.Save(ours); !errors.As(err, &conflict) {
+		t.Fatalf("Save of a stale copy = %v, want a ConflictError", err)
+	}
+	if conflict.Revision != theirs.Revision-1 || conflict.DiskRevision != theirs.Revision {
+		t.Errorf("conflict at revision %d against %d, want %d against %d", conflict.Revision, conflict.DiskRevision, theirs.Revision-1, theirs.Revision)
+	}
+	if stored, err := s.Load("home"); err != nil || stored.DefaultCurrency != "EUR" {
+		t.Fatalf("after the conflict the file has %+v (%v), want their change", stored, err)
+	}
+
+	// Forcing overwrites their change and moves past their revision
+	if err := s.ForceSave(ours); err != nil {
+		t.Fatalf("ForceSave: %v", err)
+	}
+	stored, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DefaultCurrency != "GBP" || stored.Revision != theirs.Revision+1 {
+		t.Errorf("after ForceSave the file has %s at revision %d, want GBP at %d", stored.DefaultCurrency, stored.Revision, theirs.Revision+1)
+	}
+
+	// Their copy is now the stale one
+	if err := s.Save(theirs); !errors.As(err, &conflict) {
+		t.Errorf("Save of the overwritten copy = %v, want a ConflictError", err)
+	}
+}
+
+func TestEncryptedBudgetReopens(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	dir := t.TempDir()
+	s := NewDirStore(dir)
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateWallet(s, budget, "Savings", "", "bank", "USD", NewMoney(123456, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptBudget(s, budget, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, "home.json")
+	if content, _ := os.ReadFile(filePath); bytes.Contains(content, []byte("Savings")) {
+		t.Errorf("encrypted file still shows the wallets")
+	}
+
+	// A new store stands in for the app starting again, without the key
+	reopened := NewDirStore(dir)
+	listed, err := reopened.List()
+	if err != nil || len(listed) != 1 || !listed[0].Locked() || listed[0].Name != "Home" {
+		t.Fatalf("List = %+v, %v; want Home, locked", listed, err)
+	}
+	if _, err := reopened.Load("home"); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("Load before Unlock = %v, want ErrPassphraseRequired", err)
+	}
+
+	if err := reopened.Unlock("home", "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := reopened.Load("home"); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Load after a wrong passphrase = %v, want ErrPassphraseRequired", err)
+	}
+
+	if err := reopened.Unlock("home", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := reopened.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Wallets) != 1 || loaded.Wallets[0].Balance.String() != "1234.56" || !loaded.Encrypted {
+		t.Errorf("unlocked budget has %+v", loaded.Wallets)
+	}
+	// Saving keeps it encrypted under the same passphrase
+	if err := SetDefaultCurrency(reopened, "EUR", loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDirStore(dir).Unlock("home", "correct horse"); err != nil {
+		t.Errorf("Unlock after saving: %v", err)
+	}
+}
+
+func TestUnlockRejectsIterationCounts(t *testing.T) {
+	useTestHome(t, &stubRates{})
+
+	dir := t.TempDir()
+	s := NewDirStore(dir)
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptBudget(s, budget, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, "home.json")
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := `"iterations": ` + strconv.Itoa(kdfIterations)
+	if !bytes.Contains(content, []byte(stored)) {
+		t.Fatalf("encrypted file has no %s", stored)
+	}
+
+	for _, iterations := range []int{0, -1, 1, minKDFIterations - 1, maxKDFIterations + 1, 1 << 40} {
+		tampered := strings.Replace(string(content), stored, `"iterations": `+strconv.Itoa(iterations), 1)
+		if err := os.WriteFile(filePath, []byte(tampered), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := NewDirStore(dir).Unlock("home", "correct horse")
+		if err == nil || errors.Is(err, ErrWrongPassphrase) || !strings.Contains(err.Error(), "iterations") {
+			t.Errorf("Unlock with %d iterations = %v, want the count refused", iterations, err)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type eventType string
+
+const (
+	eventCreate eventType = "create"
+	eventSave   eventType = "save"
+	eventDelete eventType = "delete"
+	eventRename eventType = "rename"
+)
+
+// storeEvent is one line of the event log. Create, save and rename events
+// carry the full budget as it was after the change.
+type storeEvent struct {
+	At      time.Time       `json:"at"`
+	Type    eventType       `json:"type"`
+	Slug    string          `json:"slug"`
+	NewSlug string          `json:"new_slug,omitempty"`
+	Budget  json.RawMessage `json:"budget,omitempty"`
+}
+
+// EventLogStore appends every change to every budget to a single log file.
+// The current state of a budget is the last event about it, so the full
+// history of changes stays available on disk. The one exception is
+// encryption: saving an encrypted budget rewrites the log so the plain copies
+// from before are replaced with the encrypted one, see scrubPlainCopies.
+type EventLogStore struct {
+	mu   sync.Mutex
+	dir  string
+	keys keyring
+}
+
+func NewEventLogStore(dir string) *EventLogStore {
+	return &EventLogStore{dir: dir}
+}
+
+func (s *EventLogStore) path() string {
+	return filepath.Join(s.dir, "events.jsonl")
+}
+
+// state replays the log and returns the latest encoded version of every budget
+func (s *EventLogStore) state() (map[string]json.RawMessage, error) {
+	budgets := make(map[string]json.RawMessage)
+
+	file, err := os.Open(s.path())
+	if os.IsNotExist(err) {
+		return budgets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %v", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var event storeEvent
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				// A crash mid-append can leave a partial last line behind
+				log.Printf("event log: skipping unreadable line %d: %v", lineNumber, jsonErr)
+			} else {
+				applyEvent(budgets, event)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event log: %v", err)
+		}
+	}
+
+	return budgets, nil
+}
+
+func applyEvent(budgets map[string]json.RawMessage, event storeEvent) {
+	switch event.Type {
+	case eventCreate, eventSave:
+		budgets[event.Slug] = event.Budget
+	case eventDelete:
+		delete(budgets, event.Slug)
+	case eventRename:
+		delete(budgets, event.Slug)
+		budgets[event.NewSlug] = event.Budget
+	}
+}
+
+func (s *EventLogStore) append(event storeEvent) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create budgets directory: %v", err)
+	}
+
+	event.At = time.Now()
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	file, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %v", err)
+	}
+
+	_, writeErr := file.Write(append(line, '\n'))
+	syncErr := file.Sync()
+	closeErr := file.Close()
+	if err := errors.Join(writeErr, syncErr, closeErr); err != nil {
+		return fmt.Errorf("failed to append to event log: %v", err)
+	}
+
+	return nil
+}
+
+func (s *EventLogStore) List() ([]BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgets, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+
+	var budgetFiles []BudgetFile
+	for slug, content := range budgets {
+		budgetFile, err := s.decode(content, slug)
+		if err != nil {
+			log.Printf("skipping budget '%s' in event log: %v", slug, err)
+			continue
+		}
+		budgetFiles = append(budgetFiles, *budgetFile)
+	}
+
+	sortByUpdated(budgetFiles)
+
+	return budgetFiles, nil
+}
+
+func (s *EventLogStore) Load(slug string) (*BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgets, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+
+	content, exists := budgets[slug]
+	if !exists {
+		return nil, fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	budgetFile, err := s.decode(content, slug)
+	if err != nil {
+		return nil, err
+	}
+	return requireUnlocked(budgetFile)
+}
+
+// decode loads an encoded budget and records an upgraded copy if it needed
+// one and this process has the budget locked, see DirStore.load. Older
+// versions stay in the log, so no separate backup is kept.
+func (s *EventLogStore) decode(content []byte, slug string) (*BudgetFile, error) {
+	budgetFile, _, needsSave, err := loadBudget(content, slug, s.keys.get(slug))
+	if err != nil {
+		return nil, err
+	}
+
+	if needsSave && s.holdsLock(slug) {
+		if err := s.saveLocked(budgetFile, false); err != nil {
+			log.Printf("budget '%s': failed to record upgraded budget: %v", slug, err)
+		}
+	}
+
+	return budgetFile, nil
+}
+
+func (s *EventLogStore) Create(name string) (*BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgetFile, err := newBudgetFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := s.state()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := budgets[budgetFile.Slug]; exists {
+		return nil, fmt.Errorf("a budget is already stored as '%s'", budgetFile.Slug)
+	}
+
+	content, err := encodeBudgetFile(budgetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.append(storeEvent{Type: eventCreate, Slug: budgetFile.Slug, Budget: content}); err != nil {
+		return nil, err
+	}
+	s.keys.remember(budgetFile)
+
+	return budgetFile, nil
+}
+
+func (s *EventLogStore) Save(budgetFile *BudgetFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveLocked(budgetFile, false)
+}
+
+func (s *EventLogStore) ForceSave(budgetFile *BudgetFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveLocked(budgetFile, true)
+}
+
+func (s *EventLogStore) saveLocked(budgetFile *BudgetFile, force bool) error {
+	budgets, err := s.state()
+	if err != nil {
+		return err
+	}
+
+	var storedRevision int64
+	var storedVersion int
+	if content, exists := budgets[budgetFile.Slug]; exists {
+		revision, version, err := readRevision(content)
+		if err != nil && !force {
+			return fmt.Errorf("failed to check budget '%s' before saving: %v", budgetFile.Name, err)
+		}
+		storedRevision, storedVersion = revision, version
+	}
+
+	if err := prepareSave(budgetFile, storedRevision, storedVersion, force); err != nil {
+		return err
+	}
+
+	content, err := encodeBudgetFile(budgetFile)
+	if err != nil {
+		return err
+	}
+
+	if err := s.append(storeEvent{Type: eventSave, Slug: budgetFile.Slug, Budget: content}); err != nil {
+		return err
+	}
+	s.keys.remember(budgetFile)
+
+	if budgetFile.Encrypted {
+		if err := s.scrubPlainCopies(budgetFile.Slug, content); err != nil {
+			return fmt.Errorf("budget '%s' was saved encrypted, but unencrypted copies remain in the event log: %v", budgetFile.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// scrubPlainCopies replaces every unencrypted copy of a budget in the log,
+// under its current slug or one it had before a rename, with sealed, its
+// encrypted state. The history of changes made before encryption is lost.
+// The log is only rewritten if such copies exist.
+func (s *EventLogStore) scrubPlainCopies(slug string, sealed json.RawMessage) error {
+	content, err := os.ReadFile(s.path())
+	if err != nil {
+		return fmt.Errorf("failed to read event log: %v", err)
+	}
+
+	// Walk back from the newest event, following the budget through renames
+	// until it was created
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	slugs := map[string]bool{slug: true}
+	changed := false
+	for i := len(lines) - 1; i >= 0; i-- {
+		var event storeEvent
+		if json.Unmarshal(lines[i], &event) != nil {
+			continue
+		}
+
+		ours := false
+		switch event.Type {
+		case eventCreate, eventSave:
+			ours = slugs[event.Slug]
+			if event.Type == eventCreate {
+				delete(slugs, event.Slug)
+			}
+		case eventRename:
+			ours = slugs[event.NewSlug]
+			if ours {
+				delete(slugs, event.NewSlug)
+				slugs[event.Slug] = true
+			}
+		case eventDelete:
+			// Earlier events under this slug were about another budget
+			delete(slugs, event.Slug)
+		}
+		if !ours {
+			continue
+		}
+		if envelope, err := parseEncryptedBudget(event.Budget); err != nil || envelope != nil {
+			continue
+		}
+
+		event.Budget = sealed
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %v", err)
+		}
+		lines[i] = append(line, '\n')
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	// Another process appending meanwhile would lose its event to the rewrite
+	if info, err := os.Stat(s.path()); err != nil || info.Size() != int64(len(content)) {
+		return fmt.Errorf("the event log changed while it was being rewritten; save again to retry")
+	}
+	if err := writeFileAtomic(s.path(), bytes.Join(lines, nil), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite event log: %v", err)
+	}
+	log.Printf("budget '%s': replaced unencrypted copies in the event log", slug)
+	return nil
+}
+
+func (s *EventLogStore) Delete(slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgets, err := s.state()
+	if err != nil {
+		return err
+	}
+	if _, exists := budgets[slug]; !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	// Refuse to delete a budget another process has open
+	lock, err := s.Lock(slug)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := s.append(storeEvent{Type: eventDelete, Slug: slug}); err != nil {
+		return err
+	}
+	s.keys.forget(slug)
+
+	return nil
+}
+
+func (s *EventLogStore) Rename(slug, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ValidateBudgetName(newName); err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	newSlug := Slugify(newName)
+
+	budgets, err := s.state()
+	if err != nil {
+		return err
+	}
+	content, exists := budgets[slug]
+	if !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+	if _, exists := budgets[newSlug]; exists && newSlug != slug {
+		return fmt.Errorf("a budget is already stored as '%s'", newSlug)
+	}
+
+	// Refuse to rename a budget another process has open
+	lock, err := s.Lock(slug)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	budgetFile, fromVersion, _, err := loadBudget(content, slug, s.keys.get(slug))
+	if err != nil {
+		return err
+	}
+
+	budgetFile.Name = newName
+	budgetFile.Slug = newSlug
+	if err := prepareSave(budgetFile, budgetFile.Revision, fromVersion, false); err != nil {
+		return err
+	}
+
+	renamed, err := encodeBudgetFile(budgetFile)
+	if err != nil {
+		return err
+	}
+
+	if err := s.append(storeEvent{Type: eventRename, Slug: slug, NewSlug: newSlug, Budget: renamed}); err != nil {
+		return err
+	}
+	s.keys.forget(slug)
+	s.keys.remember(budgetFile)
+
+	return nil
+}
+
+func (s *EventLogStore) Unlock(slug, passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgets, err := s.state()
+	if err != nil {
+		return err
+	}
+	content, exists := budgets[slug]
+	if !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	key, err := unlockBudget(content, passphrase)
+	if err != nil {
+		return err
+	}
+	s.keys.set(slug, key)
+
+	return nil
+}
+
+// Lock takes the advisory lock file for a budget
+func (s *EventLogStore) Lock(slug string) (*BudgetLock, error) {
+	if err := checkSlug(slug); err != nil {
+		return nil, err
+	}
+	return acquireLock(filepath.Join(s.dir, slug+".lock"), slug)
+}
+
+// holdsLock reports whether this process has the budget locked
+func (s *EventLogStore) holdsLock(slug string) bool {
+	return checkSlug(slug) == nil && heldHere(filepath.Join(s.dir, slug+".lock"))
+}
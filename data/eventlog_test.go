@@ -0,0 +1,63 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptScrubsPlainCopiesFromEventLog(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	dir := t.TempDir()
+	s := NewEventLogStore(dir)
+
+	other, err := s.Create("Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateWallet(s, other, "Visible Wallet", "", "", "EUR", NewMoney(100, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateWallet(s, budget, "Secret Wallet", "", "", "EUR", NewMoney(100, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename(budget.Slug, "House"); err != nil {
+		t.Fatal(err)
+	}
+	if budget, err = s.Load("house"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptBudget(s, budget, "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "Secret Wallet") {
+		t.Errorf("the event log still has the budget unencrypted")
+	}
+	if !strings.Contains(string(content), "Visible Wallet") {
+		t.Errorf("the other budget's history was lost")
+	}
+
+	reopened := NewEventLogStore(dir)
+	if err := reopened.Unlock("house", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := reopened.Load("house")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Wallets) != 1 || loaded.Wallets[0].Name != "Secret Wallet" {
+		t.Errorf("encrypted budget doesn't load back: %+v", loaded.Wallets)
+	}
+}
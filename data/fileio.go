@@ -0,0 +1,161 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var ErrBudgetLocked = errors.New("budget is open elsewhere")
+
+// renameFile moves a finished write into place; tests replace it to make a write fail
+var renameFile = os.Rename
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it and
+// renames it into place, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Clean up the temp file on any failure before the rename
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := renameFile(tmpPath, path); err != nil {
+		return err
+	}
+	success = true
+
+	// Persist the rename itself; not every platform supports syncing directories
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// BudgetLock is an advisory lock that marks a budget as open in this process
+type BudgetLock struct {
+	path string
+}
+
+// acquireLock creates the lock file for a budget. If another running process
+// holds it, the returned error wraps ErrBudgetLocked. Locks left behind by
+// processes that no longer exist are taken over.
+func acquireLock(lockPath, filename string) (*BudgetLock, error) {
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create budgets directory: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := file.WriteString(owner)
+			closeErr := file.Close()
+			if writeErr != nil || closeErr != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("failed to write lock for budget '%s'", filename)
+			}
+			return &BudgetLock{path: lockPath}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock budget '%s': %v", filename, err)
+		}
+
+		pid, host, readErr := readLockOwner(lockPath)
+		if readErr == nil && (host != hostname || processAlive(pid)) {
+			return nil, fmt.Errorf("%w (process %d on %s)", ErrBudgetLocked, pid, host)
+		}
+
+		// Stale lock from a crashed process: remove it and try again
+		os.Remove(lockPath)
+	}
+
+	return nil, fmt.Errorf("%w: could not take over stale lock", ErrBudgetLocked)
+}
+
+// Release removes the lock file. It is safe to call on a nil lock.
+func (l *BudgetLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to release budget lock: %v", err)
+	}
+	return nil
+}
+
+// heldHere reports whether the lock file at lockPath belongs to this process
+func heldHere(lockPath string) bool {
+	pid, host, err := readLockOwner(lockPath)
+	if err != nil {
+		return false
+	}
+	hostname, _ := os.Hostname()
+	return pid == os.Getpid() && host == hostname
+}
+
+func readLockOwner(lockPath string) (int, string, error) {
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed lock file: %v", err)
+	}
+
+	host := ""
+	if len(lines) > 1 {
+		host = strings.TrimSpace(lines[1])
+	}
+
+	return pid, host, nil
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess only succeeds for live processes on Windows, and signals aren't supported there
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
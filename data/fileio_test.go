@@ -0,0 +1,115 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "home.json")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("updated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(content) != "updated" || info.Mode().Perm() != 0600 {
+		t.Errorf("file has %q with mode %v, want \"updated\" with 0600", content, info.Mode().Perm())
+	}
+
+	// A write that fails before taking the file's place changes nothing
+	renameFile = func(string, string) error { return errors.New("disk full") }
+	t.Cleanup(func() { renameFile = os.Rename })
+	if err := writeFileAtomic(path, []byte("lost"), 0644); err == nil {
+		t.Fatal("writeFileAtomic succeeded with a failing rename")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "updated" {
+		t.Errorf("after a failed write the file has %q, want \"updated\"", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("failed write left %d files behind, want only home.json", len(entries))
+	}
+}
+
+func TestSecondLockOpensReadOnly(t *testing.T) {
+	useTestHome(t, &stubRates{})
+
+	s := NewDirStore(t.TempDir())
+	if _, err := s.Create("Home"); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := s.Lock("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another window of the app gets ErrBudgetLocked and can still read
+	if second, err := s.Lock("home"); !errors.Is(err, ErrBudgetLocked) {
+		second.Release()
+		t.Fatalf("second Lock = %v, want ErrBudgetLocked", err)
+	}
+	if _, err := s.Load("home"); err != nil {
+		t.Errorf("Load while locked: %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	relock, err := s.Lock("home")
+	if err != nil {
+		t.Fatalf("Lock after Release: %v", err)
+	}
+	relock.Release()
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	// A process that has exited stands in for a crashed instance of the app
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name    string
+		owner   string
+		wantErr bool
+	}{
+		{"exited process", strconv.Itoa(exited.Process.Pid) + "\n" + hostname + "\n", false},
+		{"malformed", "not a pid\n", false},
+		{"empty", "", false},
+		{"live process", strconv.Itoa(os.Getppid()) + "\n" + hostname + "\n", true},
+		// Processes on other machines can't be checked, so their locks hold
+		{"other host", strconv.Itoa(exited.Process.Pid) + "\nsomewhere-else\n", true},
+	}
+	for _, tt := range tests {
+		lockPath := filepath.Join(t.TempDir(), "home.lock")
+		if err := os.WriteFile(lockPath, []byte(tt.owner), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		lock, err := acquireLock(lockPath, "home")
+		if tt.wantErr {
+			if !errors.Is(err, ErrBudgetLocked) {
+				t.Errorf("%s: acquireLock = %v, want ErrBudgetLocked", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: acquireLock: %v", tt.name, err)
+			continue
+		}
+		if !heldHere(lockPath) {
+			t.Errorf("%s: lock not taken over", tt.name)
+		}
+		lock.Release()
+	}
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// ForecastEvent is one recurring rule or expected item landing on a day
+type ForecastEvent struct {
+	Wallet   string
+	Amount   Money // in the wallet's currency
+	Currency string
+	Memo     string
+	Expected bool
+}
+
+// ForecastDay is the projected state of the budget at the end of a day
+type ForecastDay struct {
+	Date     time.Time
+	Balances []Money // in the order of BudgetFile.Wallets
+	Total    Money   // net worth in Forecast.Currency
+	Events   []ForecastEvent
+}
+
+// Forecast projects a budget forward from today using its recurring rules
+// and expected items
+type Forecast struct {
+	Currency string
+	Days     []ForecastDay
+	// Wallets left out of the totals because their currency couldn't be converted
+	Unconverted []string
+	// Rules left out because their amount couldn't be converted to the wallet's currency
+	Skipped []string
+
+	// The first day an asset wallet that wasn't negative drops below zero, or
+	// the zero time if none does
+	FirstNegative       time.Time
+	FirstNegativeWallet string
+}
+
+// maxForecastDays keeps a typo from projecting decades ahead
+const maxForecastDays = 3650
+
+// ForecastBalances projects every wallet day by day for the given number of
+// days after today. Rules in other currencies and the totals are converted
+// at today's rates.
+func ForecastBalances(data *BudgetFile, days int, today time.Time) (*Forecast, error) {
+	if days < 1 || days > maxForecastDays {
+		return nil, fmt.Errorf("forecast length must be between 1 and %d days", maxForecastDays)
+	}
+
+	currency, err := GetDefaultCurrency(data)
+	if err != nil {
+		return nil, err
+	}
+	forecast := &Forecast{Currency: currency}
+
+	// Rates to the total's currency, looked up once per wallet
+	totalRates := make([]float64, len(data.Wallets))
+	for i, wallet := range data.Wallets {
+		rate, err := ExchangeRate(wallet.Currency, currency, currency, data.RateOverrides)
+		if err != nil {
+			totalRates[i] = -1
+			forecast.Unconverted = append(forecast.Unconverted, wallet.Name)
+			continue
+		}
+		totalRates[i] = rate
+	}
+
+	type projectedRule struct {
+		rule   RecurringRule
+		wallet int
+		amount Money
+	}
+	var rules []projectedRule
+	for _, rule := range data.Recurring {
+		if rule.Paused {
+			continue
+		}
+		walletIndex, err := FindWallet(data, rule.WalletID)
+		if err != nil {
+			continue
+		}
+		wallet := data.Wallets[walletIndex]
+		amount, _, err := rule.amountIn(wallet, currency, data.RateOverrides)
+		if err != nil {
+			forecast.Skipped = append(forecast.Skipped, fmt.Sprintf("%s %s to %s", rule.Amount, rule.Currency, wallet.Name))
+			continue
+		}
+		rules = append(rules, projectedRule{rule, walletIndex, amount})
+	}
+
+	balances := make([]Money, len(data.Wallets))
+	for i, wallet := range data.Wallets {
+		balances[i] = wallet.Balance
+	}
+
+	date := startOfDay(today)
+	for range days {
+		date = date.AddDate(0, 0, 1)
+		day := ForecastDay{Date: date}
+
+		previous := append([]Money(nil), balances...)
+		for _, r := range rules {
+			if !r.rule.activeOn(date) {
+				continue
+			}
+			balance, err := balances[r.wallet].Add(r.amount)
+			if err != nil {
+				return nil, fmt.Errorf("can't forecast '%s': %w", data.Wallets[r.wallet].Name, err)
+			}
+			balances[r.wallet] = balance
+			day.Events = append(day.Events, ForecastEvent{
+				Wallet:   data.Wallets[r.wallet].Name,
+				Amount:   r.amount,
+				Currency: data.Wallets[r.wallet].Currency,
+				Memo:     r.rule.Memo,
+				Expected: r.rule.Expected,
+			})
+		}
+
+		day.Balances = append([]Money(nil), balances...)
+		day.Total = NewMoney(0, CurrencyExponent(currency))
+		for i, balance := range balances {
+			if totalRates[i] < 0 {
+				continue
+			}
+			if data.Wallets[i].IsLiability() {
+				balance = balance.Neg()
+			}
+			converted, err := balance.MulRate(totalRates[i], CurrencyExponent(currency))
+			if err == nil {
+				day.Total, err = day.Total.Add(converted)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("can't forecast the total: %w", err)
+			}
+		}
+		forecast.Days = append(forecast.Days, day)
+
+		if forecast.FirstNegative.IsZero() {
+			for i, balance := range balances {
+				if !data.Wallets[i].IsLiability() && balance.Sign() < 0 && previous[i].Sign() >= 0 {
+					forecast.FirstNegative = date
+					forecast.FirstNegativeWallet = data.Wallets[i].Name
+					break
+				}
+			}
+		}
+	}
+
+	return forecast, nil
+}
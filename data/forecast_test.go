@@ -0,0 +1,81 @@
+package data
+
+import "testing"
+
+func TestForecastBalances(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	s, budget, checking := newTestBudget(t)
+
+	// A USD credit card owing 200.00, worth 160.00 EUR against net worth
+	if err := CreateWallet(s, budget, "Card", "", TypeCreditCard, "USD", NewMoney(20000, 2)); err != nil {
+		t.Fatal(err)
+	}
+	card := budget.Wallets[1].ID
+
+	for _, rule := range []RecurringRule{
+		{WalletID: checking, Amount: NewMoney(100000, 2), Cadence: CadenceMonthly, Start: "2025-01-31", Memo: "Salary"},
+		{WalletID: checking, Amount: NewMoney(-80000, 2), Cadence: CadenceMonthly, Start: "2025-01-01", Memo: "Rent"},
+		{WalletID: checking, Amount: NewMoney(-15000, 2), Cadence: CadenceMonthly, Start: "2025-01-20", Memo: "Insurance", Expected: true},
+		{WalletID: card, Amount: NewMoney(2500, 2), Cadence: CadenceWeekly, Start: "2025-01-13", Memo: "Groceries"},
+		{WalletID: card, Amount: NewMoney(1000, 2), Cadence: CadenceDaily, Start: "2025-01-01", Paused: true},
+	} {
+		if err := AddRecurringRule(s, budget, rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	forecast, err := ForecastBalances(budget, 30, mustDate(t, "2025-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast.Days) != 30 || forecast.Currency != "EUR" {
+		t.Fatalf("forecast has %d days in %s, want 30 in EUR", len(forecast.Days), forecast.Currency)
+	}
+
+	tests := []struct {
+		day      int // days after today
+		date     string
+		checking string
+		card     string
+		total    string
+		events   int
+	}{
+		{1, "2025-01-11", "100.00", "200.00", "-60.00", 0},
+		{3, "2025-01-13", "100.00", "225.00", "-80.00", 1},
+		{10, "2025-01-20", "-50.00", "250.00", "-250.00", 2},
+		{21, "2025-01-31", "950.00", "275.00", "730.00", 1},
+		{22, "2025-02-01", "150.00", "275.00", "-70.00", 1},
+		{30, "2025-02-09", "150.00", "300.00", "-90.00", 0},
+	}
+	for _, tt := range tests {
+		day := forecast.Days[tt.day-1]
+		if got := day.Date.Format(dateLayout); got != tt.date {
+			t.Errorf("day %d is %s, want %s", tt.day, got, tt.date)
+		}
+		if got := day.Balances[0].String(); got != tt.checking {
+			t.Errorf("%s: checking = %s, want %s", tt.date, got, tt.checking)
+		}
+		if got := day.Balances[1].String(); got != tt.card {
+			t.Errorf("%s: card = %s, want %s", tt.date, got, tt.card)
+		}
+		if got := day.Total.String(); got != tt.total {
+			t.Errorf("%s: total = %s, want %s", tt.date, got, tt.total)
+		}
+		if len(day.Events) != tt.events {
+			t.Errorf("%s: %d events, want %d", tt.date, len(day.Events), tt.events)
+		}
+	}
+
+	// The expected insurance payment is what first takes checking below zero
+	if got := forecast.FirstNegative.Format(dateLayout); got != "2025-01-20" || forecast.FirstNegativeWallet != "Checking" {
+		t.Errorf("first negative %s in '%s', want 2025-01-20 in 'Checking'", got, forecast.FirstNegativeWallet)
+	}
+	// Forecasting posts nothing
+	if budget.Wallets[0].Balance.String() != "100.00" || budget.Recurring[0].PostedThrough != "" {
+		t.Errorf("forecast changed the budget")
+	}
+
+	if _, err := ForecastBalances(budget, maxForecastDays+1, mustDate(t, "2025-01-10")); err == nil {
+		t.Errorf("forecast past %d days succeeded", maxForecastDays)
+	}
+}
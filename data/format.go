@@ -0,0 +1,120 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FormatAmount prints an amount with as many decimals as its currency has,
+// so 1200 JPY and 1.500 KWD print as such whatever they were stored with
+func FormatAmount(amount Money, currency string) string {
+	rescaled, err := amount.Rescale(CurrencyExponent(currency))
+	if err != nil {
+		return amount.String()
+	}
+	return rescaled.String()
+}
+
+// CurrencySymbol returns the symbol of a currency or unit, or "" if it has none
+func CurrencySymbol(currency string) string {
+	unit, err := LookupUnit(currency)
+	if err != nil {
+		return ""
+	}
+	return unit.Symbol
+}
+
+// FormatWithSymbol prints an amount as "$12.50" or "-€3.00", falling back
+// to "12.50 CHF" for currencies without a symbol
+func FormatWithSymbol(amount Money, currency string) string {
+	symbol := CurrencySymbol(currency)
+	if symbol == "" {
+		return fmt.Sprintf("%s %s", FormatAmount(amount, currency), strings.ToUpper(currency))
+	}
+
+	formatted := FormatAmount(amount, currency)
+	if digits, negative := strings.CutPrefix(formatted, "-"); negative {
+		return "-" + symbol + digits
+	}
+	return symbol + formatted
+}
+
+// stripThousands removes the separators between thousands from the whole part
+// of an amount. It fails unless every separator starts a group of three digits.
+func stripThousands(s string) (string, bool) {
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	if strings.ContainsAny(fraction, ",_ ") {
+		return "", false
+	}
+
+	groups := strings.Split(strings.NewReplacer("_", ",", " ", ",").Replace(whole), ",")
+	if len(groups) > 1 && (len(groups[0]) == 0 || len(groups[0]) > 3) {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+
+	s = strings.Join(groups, "")
+	if hasFraction {
+		s += "." + fraction
+	}
+	return s, true
+}
+
+// ParseAmount parses an amount typed in a currency, such as "+$1,200.50",
+// "-50 EUR" or "¥1000". The currency's symbol or code is optional, and
+// commas, underscores or spaces may separate thousands. Anything else that
+// looks like a separator, such as the decimal comma in "1,5", is refused as
+// ambiguous, and so are amounts with more decimals than the currency allows,
+// rather than rounded.
+func ParseAmount(s, currency string) (Money, error) {
+	original := s
+	s = strings.TrimSpace(s)
+
+	sign := ""
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		sign, s = s[:1], s[1:]
+	}
+
+	unit, err := LookupUnit(currency)
+	if err == nil {
+		s = strings.TrimSpace(s)
+		if unit.Symbol != "" {
+			s = strings.TrimPrefix(s, unit.Symbol)
+		}
+		if upper := strings.ToUpper(s); strings.HasSuffix(upper, unit.Code) {
+			s = s[:len(s)-len(unit.Code)]
+		} else if strings.HasPrefix(upper, unit.Code) {
+			s = s[len(unit.Code):]
+		}
+	}
+	s, ok := stripThousands(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("ambiguous amount '%s': use '.' for decimals and ',' only between thousands", strings.TrimSpace(original))
+	}
+
+	amount, err := parseDecimal(sign + s)
+	if errors.Is(err, ErrOutOfRange) {
+		return Money{}, fmt.Errorf("%w: '%s'", ErrOutOfRange, strings.TrimSpace(original))
+	}
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount '%s'", strings.TrimSpace(original))
+	}
+
+	exp := CurrencyExponent(currency)
+	rescaled, err := amount.Rescale(exp)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: '%s'", err, strings.TrimSpace(original))
+	}
+	if rescaled.Cmp(amount) != 0 {
+		if exp == 0 {
+			return Money{}, fmt.Errorf("%s has no decimals", strings.ToUpper(currency))
+		}
+		return Money{}, fmt.Errorf("%s has only %d decimal places", strings.ToUpper(currency), exp)
+	}
+	return rescaled, nil
+}
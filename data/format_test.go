@@ -0,0 +1,47 @@
+package data
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         string
+		wantErr      bool
+	}{
+		{"1200.50", "USD", "1200.50", false},
+		{"+$1,200.50", "USD", "1200.50", false},
+		{"-50 EUR", "EUR", "-50.00", false},
+		{"¥1000", "JPY", "1000", false},
+		{"1,234,567.89", "USD", "1234567.89", false},
+		{"1_000", "USD", "1000.00", false},
+		{"10 000", "USD", "10000.00", false},
+		{"999", "USD", "999.00", false},
+		{".5", "USD", "0.50", false},
+		{"1,5", "EUR", "", true},
+		{"1,50", "EUR", "", true},
+		{"12,34.5", "USD", "", true},
+		{"1234,567", "USD", "", true},
+		{",100", "USD", "", true},
+		{"1,,000", "USD", "", true},
+		{"1.000,50", "EUR", "", true},
+		{"1.005", "USD", "", true},
+		{"1.5", "JPY", "", true},
+		{"abc", "USD", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %s) = %s, want an error", tt.in, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %s): %v", tt.in, tt.currency, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseAmount(%q, %s) = %s, want %s", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
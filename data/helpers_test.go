@@ -0,0 +1,52 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// stubRates serves fixed rates, quoted per one EUR, against any base they
+// cover, and counts how often it was asked
+type stubRates struct {
+	rates map[string]float64
+	calls int
+}
+
+func (p *stubRates) Name() string {
+	return "stub"
+}
+
+func (p *stubRates) Rates(base string) (map[string]float64, error) {
+	p.calls++
+	rates, ok := rebaseRates(p.rates, "EUR", base)
+	if !ok {
+		return nil, fmt.Errorf("stub has no rate for %s", base)
+	}
+	return rates, nil
+}
+
+func (p *stubRates) RatesOn(base string, day time.Time) (map[string]float64, error) {
+	return p.Rates(base)
+}
+
+// useTestHome points the app at a fresh folder and takes rates from provider
+func useTestHome(t *testing.T, provider RateProvider) Paths {
+	t.Helper()
+
+	t.Setenv("BUDGET_HOME", t.TempDir())
+	p, err := Configure("")
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	SetRateProvider(provider)
+	t.Cleanup(func() {
+		SetRateProvider(nil)
+		SetOffline(false)
+		fetchFailures.mu.Lock()
+		fetchFailures.byBase = nil
+		fetchFailures.mu.Unlock()
+	})
+	return p
+}
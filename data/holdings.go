@@ -0,0 +1,213 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Holding is a position in a wallet, such as shares of a fund. Its value is
+// part of the wallet's balance; anything else in the balance is cash.
+type Holding struct {
+	Symbol    string `json:"symbol"`
+	Quantity  Money  `json:"quantity"`
+	CostBasis Money  `json:"cost_basis"` // total paid, in the wallet's currency
+	Value     Money  `json:"value"`      // at the last valuation, in the wallet's currency
+}
+
+// Gain returns the unrealized gain at the last valuation
+func (h Holding) Gain() (Money, error) {
+	return h.Value.Sub(h.CostBasis)
+}
+
+// HoldingsTotals adds up the value and cost basis of the wallet's holdings
+func (w Wallet) HoldingsTotals() (value, cost Money, err error) {
+	exp := CurrencyExponent(w.Currency)
+	value, cost = NewMoney(0, exp), NewMoney(0, exp)
+	for _, holding := range w.Holdings {
+		if value, err = value.Add(holding.Value); err != nil {
+			return Money{}, Money{}, err
+		}
+		if cost, err = cost.Add(holding.CostBasis); err != nil {
+			return Money{}, Money{}, err
+		}
+	}
+	return value, cost, nil
+}
+
+// valueHolding prices a holding in the wallet's currency
+func valueHolding(wallet Wallet, holding Holding, prices PriceProvider, base string, overrides RateOverrides) (Money, error) {
+	price, err := prices.Price(holding.Symbol)
+	if err != nil {
+		return Money{}, err
+	}
+
+	rate := 1.0
+	if price.Currency != "" && price.Currency != wallet.Currency {
+		rate, err = ExchangeRate(price.Currency, wallet.Currency, base, overrides)
+		if err != nil {
+			return Money{}, fmt.Errorf("can't convert the %s price from %s: %v", holding.Symbol, price.Currency, err)
+		}
+	}
+
+	// Keep the converted price precise and round only the total
+	converted, err := price.Value.MulRate(rate, 8)
+	if err != nil {
+		return Money{}, fmt.Errorf("can't convert the %s price: %w", holding.Symbol, err)
+	}
+	value, err := holding.Quantity.Mul(converted, CurrencyExponent(wallet.Currency))
+	if err != nil {
+		return Money{}, fmt.Errorf("can't value %s %s: %w", holding.Quantity, holding.Symbol, err)
+	}
+	return value, nil
+}
+
+// revalueHoldings updates the value of every holding that has a price and
+// posts the change to its wallet's balance. It returns the symbols that
+// couldn't be priced, which keep their last value.
+func revalueHoldings(data *BudgetFile, prices PriceProvider) (unpriced []string, changed bool, err error) {
+	base, _ := GetDefaultCurrency(data)
+
+	for i := range data.Wallets {
+		wallet := &data.Wallets[i]
+		change := NewMoney(0, CurrencyExponent(wallet.Currency))
+		var memo []string
+
+		for j := range wallet.Holdings {
+			holding := &wallet.Holdings[j]
+			value, err := valueHolding(*wallet, *holding, prices, base, data.RateOverrides)
+			if err != nil {
+				if !slices.Contains(unpriced, holding.Symbol) {
+					unpriced = append(unpriced, holding.Symbol)
+				}
+				if !errors.Is(err, ErrNoPrice) {
+					log.Printf("pricing %s in '%s': %v", holding.Symbol, wallet.Name, err)
+				}
+				continue
+			}
+			if value.Cmp(holding.Value) == 0 {
+				continue
+			}
+
+			difference, err := value.Sub(holding.Value)
+			if err == nil {
+				change, err = change.Add(difference)
+			}
+			if err != nil {
+				return nil, false, fmt.Errorf("can't revalue '%s': %w", wallet.Name, err)
+			}
+			holding.Value = value
+			memo = append(memo, holding.Symbol)
+		}
+
+		if len(memo) > 0 {
+			changed = true
+			if change.IsZero() {
+				continue
+			}
+			if err := wallet.post(TransactionRevalue, change, "Revalued "+strings.Join(memo, ", ")); err != nil {
+				return nil, false, fmt.Errorf("can't revalue '%s': %w", wallet.Name, err)
+			}
+		}
+	}
+
+	return unpriced, changed, nil
+}
+
+// RevalueHoldings prices every holding and moves wallet balances with their
+// value, saving only if something changed. It returns the symbols no price
+// was found for.
+func RevalueHoldings(s Store, data *BudgetFile, prices PriceProvider) ([]string, error) {
+	// Look before journaling so an unchanged budget gets no empty undo step
+	trial := *data
+	trial.Wallets = copyWallets(data.Wallets)
+	unpriced, changed, err := revalueHoldings(&trial, prices)
+	if err != nil || !changed {
+		return unpriced, err
+	}
+
+	err = data.journal("revalue holdings", func() error {
+		_, _, err := revalueHoldings(data, prices)
+		return err
+	})
+	if err != nil {
+		return unpriced, err
+	}
+	return unpriced, s.Save(data)
+}
+
+// SetHolding adds a holding to a wallet or updates its quantity, and values
+// it straight away if a price is known. A nil costBasis keeps the current one,
+// and a zero quantity removes the holding.
+func SetHolding(s Store, data *BudgetFile, walletID, symbol string, quantity Money, costBasis *Money, prices PriceProvider) error {
+	index, err := FindWallet(data, walletID)
+	if err != nil {
+		return err
+	}
+	symbol, err = normalizeSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if quantity.Sign() < 0 {
+		return fmt.Errorf("quantity can't be negative")
+	}
+	if costBasis != nil && costBasis.Sign() < 0 {
+		return fmt.Errorf("cost basis can't be negative")
+	}
+
+	wallet := &data.Wallets[index]
+	if wallet.IsLiability() {
+		return fmt.Errorf("'%s' is a %s wallet and can't hold investments", wallet.Name, wallet.Type)
+	}
+
+	position := slices.IndexFunc(wallet.Holdings, func(h Holding) bool { return h.Symbol == symbol })
+	if position < 0 && quantity.IsZero() {
+		return fmt.Errorf("'%s' has no %s holding", wallet.Name, symbol)
+	}
+
+	description := fmt.Sprintf("hold %s %s in '%s'", quantity, symbol, wallet.Name)
+	if quantity.IsZero() {
+		description = fmt.Sprintf("remove %s from '%s'", symbol, wallet.Name)
+	}
+
+	exp := CurrencyExponent(wallet.Currency)
+	var basis Money
+	if costBasis != nil {
+		if basis, err = costBasis.Rescale(exp); err != nil {
+			return fmt.Errorf("invalid cost basis: %w", err)
+		}
+	}
+
+	err = data.journal(description, func() error {
+		if quantity.IsZero() {
+			value := wallet.Holdings[position].Value
+			wallet.Holdings = slices.Delete(wallet.Holdings, position, position+1)
+			if value.IsZero() {
+				return nil
+			}
+			return wallet.post(TransactionRevalue, value.Neg(), "Removed "+symbol)
+		}
+
+		if position < 0 {
+			wallet.Holdings = append(wallet.Holdings, Holding{
+				Symbol:    symbol,
+				CostBasis: NewMoney(0, exp),
+				Value:     NewMoney(0, exp),
+			})
+			position = len(wallet.Holdings) - 1
+		}
+		holding := &wallet.Holdings[position]
+		holding.Quantity = quantity
+		if costBasis != nil {
+			holding.CostBasis = basis
+		}
+		_, _, err := revalueHoldings(data, prices)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
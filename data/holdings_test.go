@@ -0,0 +1,84 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestHoldingValues(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25, "JPY": 160}})
+
+	tests := []struct {
+		name     string
+		currency string // the wallet's
+		quantity Money
+		price    Money
+		priced   string // currency of the price, the wallet's if empty
+		want     string
+	}{
+		{"whole shares", "USD", NewMoney(3, 0), NewMoney(19050, 2), "", "571.50"},
+		{"rounded up", "USD", NewMoney(3, 0), NewMoney(33333, 3), "", "100.00"},
+		{"rounded down", "USD", NewMoney(7, 0), NewMoney(333, 3), "", "2.33"},
+		{"half a cent", "USD", NewMoney(5, 1), NewMoney(1, 2), "", "0.01"},
+		{"fractional quantity", "EUR", NewMoney(12345678, 8), NewMoney(6500000, 2), "", "8024.69"},
+		{"no minor units", "JPY", NewMoney(3, 0), NewMoney(3333, 2), "", "100"},
+		{"converted", "EUR", NewMoney(15, 1), NewMoney(10000, 2), "USD", "120.00"},
+		{"converted then rounded", "JPY", NewMoney(1, 0), NewMoney(999, 2), "USD", "1279"},
+	}
+	for _, tt := range tests {
+		wallet := Wallet{Name: "Broker", Currency: tt.currency}
+		holding := Holding{Symbol: "FUND", Quantity: tt.quantity}
+		prices := ManualPrices(&BudgetFile{Prices: map[string]Price{"FUND": {Value: tt.price, Currency: tt.priced}}})
+
+		got, err := valueHolding(wallet, holding, prices, "EUR", nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s: %s x %s = %s, want %s", tt.name, tt.quantity, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestHoldingsTotals(t *testing.T) {
+	tests := []struct {
+		name      string
+		currency  string
+		holdings  []Holding
+		wantValue string
+		wantCost  string
+	}{
+		{"none", "USD", nil, "0.00", "0.00"},
+		{"none without minor units", "JPY", nil, "0", "0"},
+		{
+			name: "several", currency: "USD",
+			holdings: []Holding{
+				{Symbol: "AAPL", Value: NewMoney(57150, 2), CostBasis: NewMoney(45000, 2)},
+				{Symbol: "VWCE", Value: NewMoney(233, 2), CostBasis: NewMoney(300, 2)},
+				{Symbol: "GOLD", Value: NewMoney(0, 2), CostBasis: NewMoney(1, 2)},
+			},
+			wantValue: "573.83", wantCost: "453.01",
+		},
+	}
+	for _, tt := range tests {
+		wallet := Wallet{Currency: tt.currency, Holdings: tt.holdings}
+		value, cost, err := wallet.HoldingsTotals()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if value.String() != tt.wantValue || cost.String() != tt.wantCost {
+			t.Errorf("%s: totals %s and %s, want %s and %s", tt.name, value, cost, tt.wantValue, tt.wantCost)
+		}
+	}
+
+	wallet := Wallet{Currency: "USD", Holdings: []Holding{
+		{Symbol: "A", Value: NewMoney(math.MaxInt64, 2)},
+		{Symbol: "B", Value: NewMoney(1, 2)},
+	}}
+	if _, _, err := wallet.HoldingsTotals(); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("HoldingsTotals past int64 = %v, want ErrOutOfRange", err)
+	}
+}
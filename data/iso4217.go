@@ -0,0 +1,187 @@
+package data
+
+// isoCurrency is the ISO 4217 metadata of a fiat currency
+type isoCurrency struct {
+	name   string
+	minor  int    // digits after the decimal point
+	symbol string // empty if the code is clearer than any symbol
+}
+
+// isoCurrencies lists the active ISO 4217 currencies
+var isoCurrencies = map[string]isoCurrency{
+	"AED": {"UAE Dirham", 2, "د.إ"},
+	"AFN": {"Afghani", 2, "؋"},
+	"ALL": {"Lek", 2, ""},
+	"AMD": {"Armenian Dram", 2, "֏"},
+	"ANG": {"Netherlands Antillean Guilder", 2, "ƒ"},
+	"AOA": {"Kwanza", 2, "Kz"},
+	"ARS": {"Argentine Peso", 2, "AR$"},
+	"AUD": {"Australian Dollar", 2, "A$"},
+	"AWG": {"Aruban Florin", 2, "ƒ"},
+	"AZN": {"Azerbaijan Manat", 2, "₼"},
+	"BAM": {"Convertible Mark", 2, "KM"},
+	"BBD": {"Barbados Dollar", 2, "Bds$"},
+	"BDT": {"Taka", 2, "৳"},
+	"BGN": {"Bulgarian Lev", 2, "лв"},
+	"BHD": {"Bahraini Dinar", 3, ""},
+	"BIF": {"Burundi Franc", 0, "FBu"},
+	"BMD": {"Bermudian Dollar", 2, ""},
+	"BND": {"Brunei Dollar", 2, "B$"},
+	"BOB": {"Boliviano", 2, "Bs"},
+	"BRL": {"Brazilian Real", 2, "R$"},
+	"BSD": {"Bahamian Dollar", 2, ""},
+	"BTN": {"Ngultrum", 2, "Nu."},
+	"BWP": {"Pula", 2, "P"},
+	"BYN": {"Belarusian Ruble", 2, "Br"},
+	"BZD": {"Belize Dollar", 2, "BZ$"},
+	"CAD": {"Canadian Dollar", 2, "CA$"},
+	"CDF": {"Congolese Franc", 2, "FC"},
+	"CHF": {"Swiss Franc", 2, ""},
+	"CLF": {"Unidad de Fomento", 4, ""},
+	"CLP": {"Chilean Peso", 0, "CL$"},
+	"CNY": {"Yuan Renminbi", 2, "CN¥"},
+	"COP": {"Colombian Peso", 2, "COL$"},
+	"CRC": {"Costa Rican Colon", 2, "₡"},
+	"CUP": {"Cuban Peso", 2, ""},
+	"CVE": {"Cabo Verde Escudo", 2, ""},
+	"CZK": {"Czech Koruna", 2, "Kč"},
+	"DJF": {"Djibouti Franc", 0, "Fdj"},
+	"DKK": {"Danish Krone", 2, "kr."},
+	"DOP": {"Dominican Peso", 2, "RD$"},
+	"DZD": {"Algerian Dinar", 2, ""},
+	"EGP": {"Egyptian Pound", 2, "E£"},
+	"ERN": {"Nakfa", 2, "Nfk"},
+	"ETB": {"Ethiopian Birr", 2, "Br"},
+	"EUR": {"Euro", 2, "€"},
+	"FJD": {"Fiji Dollar", 2, "FJ$"},
+	"FKP": {"Falkland Islands Pound", 2, ""},
+	"GBP": {"Pound Sterling", 2, "£"},
+	"GEL": {"Lari", 2, "₾"},
+	"GHS": {"Ghana Cedi", 2, "GH₵"},
+	"GIP": {"Gibraltar Pound", 2, ""},
+	"GMD": {"Dalasi", 2, "D"},
+	"GNF": {"Guinean Franc", 0, "FG"},
+	"GTQ": {"Quetzal", 2, "Q"},
+	"GYD": {"Guyana Dollar", 2, "G$"},
+	"HKD": {"Hong Kong Dollar", 2, "HK$"},
+	"HNL": {"Lempira", 2, "L"},
+	"HTG": {"Gourde", 2, "G"},
+	"HUF": {"Forint", 2, "Ft"},
+	"IDR": {"Rupiah", 2, "Rp"},
+	"ILS": {"New Israeli Sheqel", 2, "₪"},
+	"INR": {"Indian Rupee", 2, "₹"},
+	"IQD": {"Iraqi Dinar", 3, ""},
+	"IRR": {"Iranian Rial", 2, ""},
+	"ISK": {"Iceland Krona", 0, ""},
+	"JMD": {"Jamaican Dollar", 2, "J$"},
+	"JOD": {"Jordanian Dinar", 3, ""},
+	"JPY": {"Yen", 0, "¥"},
+	"KES": {"Kenyan Shilling", 2, "KSh"},
+	"KGS": {"Som", 2, ""},
+	"KHR": {"Riel", 2, "៛"},
+	"KMF": {"Comorian Franc", 0, "CF"},
+	"KPW": {"North Korean Won", 2, ""},
+	"KRW": {"Won", 0, "₩"},
+	"KWD": {"Kuwaiti Dinar", 3, ""},
+	"KYD": {"Cayman Islands Dollar", 2, "CI$"},
+	"KZT": {"Tenge", 2, "₸"},
+	"LAK": {"Lao Kip", 2, "₭"},
+	"LBP": {"Lebanese Pound", 2, ""},
+	"LKR": {"Sri Lanka Rupee", 2, "Rs"},
+	"LRD": {"Liberian Dollar", 2, "L$"},
+	"LSL": {"Loti", 2, ""},
+	"LYD": {"Libyan Dinar", 3, ""},
+	"MAD": {"Moroccan Dirham", 2, ""},
+	"MDL": {"Moldovan Leu", 2, ""},
+	"MGA": {"Malagasy Ariary", 2, "Ar"},
+	"MKD": {"Denar", 2, ""},
+	"MMK": {"Kyat", 2, "K"},
+	"MNT": {"Tugrik", 2, "₮"},
+	"MOP": {"Pataca", 2, "MOP$"},
+	"MRU": {"Ouguiya", 2, "UM"},
+	"MUR": {"Mauritius Rupee", 2, "Rs"},
+	"MVR": {"Rufiyaa", 2, "Rf"},
+	"MWK": {"Malawi Kwacha", 2, "MK"},
+	"MXN": {"Mexican Peso", 2, "MX$"},
+	"MYR": {"Malaysian Ringgit", 2, "RM"},
+	"MZN": {"Mozambique Metical", 2, "MT"},
+	"NAD": {"Namibia Dollar", 2, "N$"},
+	"NGN": {"Naira", 2, "₦"},
+	"NIO": {"Cordoba Oro", 2, "C$"},
+	"NOK": {"Norwegian Krone", 2, "kr"},
+	"NPR": {"Nepalese Rupee", 2, "Rs"},
+	"NZD": {"New Zealand Dollar", 2, "NZ$"},
+	"OMR": {"Rial Omani", 3, ""},
+	"PAB": {"Balboa", 2, "B/."},
+	"PEN": {"Sol", 2, "S/"},
+	"PGK": {"Kina", 2, "K"},
+	"PHP": {"Philippine Peso", 2, "₱"},
+	"PKR": {"Pakistan Rupee", 2, "Rs"},
+	"PLN": {"Zloty", 2, "zł"},
+	"PYG": {"Guarani", 0, "₲"},
+	"QAR": {"Qatari Rial", 2, ""},
+	"RON": {"Romanian Leu", 2, "lei"},
+	"RSD": {"Serbian Dinar", 2, ""},
+	"RUB": {"Russian Ruble", 2, "₽"},
+	"RWF": {"Rwanda Franc", 0, "FRw"},
+	"SAR": {"Saudi Riyal", 2, ""},
+	"SBD": {"Solomon Islands Dollar", 2, "SI$"},
+	"SCR": {"Seychelles Rupee", 2, ""},
+	"SDG": {"Sudanese Pound", 2, ""},
+	"SEK": {"Swedish Krona", 2, "kr"},
+	"SGD": {"Singapore Dollar", 2, "S$"},
+	"SHP": {"Saint Helena Pound", 2, ""},
+	"SLE": {"Leone", 2, "Le"},
+	"SOS": {"Somali Shilling", 2, "Sh"},
+	"SRD": {"Surinam Dollar", 2, ""},
+	"SSP": {"South Sudanese Pound", 2, ""},
+	"STN": {"Dobra", 2, "Db"},
+	"SVC": {"El Salvador Colon", 2, ""},
+	"SYP": {"Syrian Pound", 2, ""},
+	"SZL": {"Lilangeni", 2, "E"},
+	"THB": {"Baht", 2, "฿"},
+	"TJS": {"Somoni", 2, ""},
+	"TMT": {"Turkmenistan New Manat", 2, ""},
+	"TND": {"Tunisian Dinar", 3, ""},
+	"TOP": {"Pa’anga", 2, "T$"},
+	"TRY": {"Turkish Lira", 2, "₺"},
+	"TTD": {"Trinidad and Tobago Dollar", 2, "TT$"},
+	"TWD": {"New Taiwan Dollar", 2, "NT$"},
+	"TZS": {"Tanzanian Shilling", 2, "TSh"},
+	"UAH": {"Hryvnia", 2, "₴"},
+	"UGX": {"Uganda Shilling", 0, "USh"},
+	"USD": {"US Dollar", 2, "$"},
+	"UYU": {"Peso Uruguayo", 2, "$U"},
+	"UYW": {"Unidad Previsional", 4, ""},
+	"UZS": {"Uzbekistan Sum", 2, ""},
+	"VED": {"Bolívar Soberano", 2, ""},
+	"VES": {"Bolívar Soberano", 2, "Bs.S"},
+	"VND": {"Dong", 0, "₫"},
+	"VUV": {"Vatu", 0, "VT"},
+	"WST": {"Tala", 2, "WS$"},
+	"XAF": {"CFA Franc BEAC", 0, "FCFA"},
+	"XCD": {"East Caribbean Dollar", 2, "EC$"},
+	"XCG": {"Caribbean Guilder", 2, "Cg"},
+	"XOF": {"CFA Franc BCEAO", 0, "CFA"},
+	"XPF": {"CFP Franc", 0, "₣"},
+	"YER": {"Yemeni Rial", 2, ""},
+	"ZAR": {"Rand", 2, "R"},
+	"ZMW": {"Zambian Kwacha", 2, "ZK"},
+	"ZWG": {"Zimbabwe Gold", 2, "ZiG"},
+}
+
+// providerCurrencies are codes outside ISO 4217 that the rate providers still
+// quote: local issues of another currency, and codes since withdrawn
+var providerCurrencies = map[string]isoCurrency{
+	"CNH": {"Offshore Yuan", 2, ""},
+	"FOK": {"Faroese Króna", 2, ""},
+	"GGP": {"Guernsey Pound", 2, ""},
+	"HRK": {"Croatian Kuna", 2, ""},
+	"IMP": {"Manx Pound", 2, ""},
+	"JEP": {"Jersey Pound", 2, ""},
+	"KID": {"Kiribati Dollar", 2, ""},
+	"SLL": {"Leone (withdrawn)", 2, ""},
+	"TVD": {"Tuvaluan Dollar", 2, ""},
+	"XDR": {"Special Drawing Right", 2, ""},
+	"ZWL": {"Zimbabwe Dollar (withdrawn)", 2, ""},
+}
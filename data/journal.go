@@ -0,0 +1,379 @@
+package data
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// maxJournalEntries caps how many steps can be undone
+const maxJournalEntries = 100
+
+// JournalEntry records one change to a budget as the wallets and settings it
+// touched, before and after, so it can be undone and redone.
+type JournalEntry struct {
+	At          time.Time      `json:"at"`
+	Description string         `json:"description"`
+	Changes     []WalletChange `json:"changes,omitempty"`
+	// Default currency before and after, if the change set it
+	CurrencyBefore string `json:"currency_before,omitempty"`
+	CurrencyAfter  string `json:"currency_after,omitempty"`
+	// Manual prices the change set, see SetPrice
+	Prices []PriceChange `json:"prices,omitempty"`
+	// Exchange rate overrides the change set, see SetRateOverride
+	RateOverrides []RateOverrideChange `json:"rate_overrides,omitempty"`
+	Recurring     []RecurringChange    `json:"recurring,omitempty"`
+}
+
+// PriceChange is a manual price before and after a change; nil means unset
+type PriceChange struct {
+	Symbol string `json:"symbol"`
+	Before *Price `json:"before,omitempty"`
+	After  *Price `json:"after,omitempty"`
+}
+
+// RateOverrideChange is an override before and after a change; nil means unset
+type RateOverrideChange struct {
+	Pair   string        `json:"pair"`
+	Before *RateOverride `json:"before,omitempty"`
+	After  *RateOverride `json:"after,omitempty"`
+}
+
+// RecurringChange is a recurring rule before and after a change; nil means
+// the rule didn't exist
+type RecurringChange struct {
+	ID     string         `json:"id"`
+	Index  int            `json:"index"` // position of a deleted rule, to restore it in place
+	Before *RecurringRule `json:"before,omitempty"`
+	After  *RecurringRule `json:"after,omitempty"`
+}
+
+// WalletChange is one wallet as it was before and after a change. A created
+// wallet is kept whole in After and a deleted one in Before. An edited wallet
+// has both without its ledger, which only grows: Added holds the entries the
+// change appended.
+type WalletChange struct {
+	Index  int           `json:"index"` // position of a deleted wallet, to restore it in place
+	Before *Wallet       `json:"before,omitempty"`
+	After  *Wallet       `json:"after,omitempty"`
+	Added  []Transaction `json:"added,omitempty"`
+}
+
+// walletEdit records an edited wallet without its ledger, see WalletChange
+func walletEdit(before, after Wallet, index int) WalletChange {
+	added := slices.Clone(after.Transactions[len(before.Transactions):])
+	before.Transactions, after.Transactions = nil, nil
+	return WalletChange{Index: index, Before: copyWallet(before), After: copyWallet(after), Added: added}
+}
+
+func copyWallet(wallet Wallet) *Wallet {
+	wallet.Transactions = slices.Clone(wallet.Transactions)
+	wallet.Holdings = slices.Clone(wallet.Holdings)
+	return &wallet
+}
+
+func copyWallets(wallets []Wallet) []Wallet {
+	copied := make([]Wallet, len(wallets))
+	for i, wallet := range wallets {
+		copied[i] = *copyWallet(wallet)
+	}
+	return copied
+}
+
+// journal runs mutate and records what it changed. If mutate fails the budget
+// is put back as it was and nothing is recorded. Anything that was undone can
+// no longer be redone once something else changes.
+func (b *BudgetFile) journal(description string, mutate func() error) error {
+	before := copyWallets(b.Wallets)
+	currencyBefore := b.DefaultCurrency
+	pricesBefore := maps.Clone(b.Prices)
+	overridesBefore := maps.Clone(b.RateOverrides)
+	rulesBefore := slices.Clone(b.Recurring)
+
+	if err := mutate(); err != nil {
+		b.Wallets = before
+		b.DefaultCurrency = currencyBefore
+		b.Prices = pricesBefore
+		b.RateOverrides = overridesBefore
+		b.Recurring = rulesBefore
+		return err
+	}
+
+	entry := JournalEntry{At: time.Now(), Description: description}
+	for i, old := range before {
+		index := slices.IndexFunc(b.Wallets, func(w Wallet) bool { return w.ID == old.ID })
+		if index < 0 {
+			entry.Changes = append(entry.Changes, WalletChange{Index: i, Before: copyWallet(old)})
+		} else if !reflect.DeepEqual(old, b.Wallets[index]) {
+			entry.Changes = append(entry.Changes, walletEdit(old, b.Wallets[index], index))
+		}
+	}
+	for i, wallet := range b.Wallets {
+		if !slices.ContainsFunc(before, func(w Wallet) bool { return w.ID == wallet.ID }) {
+			entry.Changes = append(entry.Changes, WalletChange{Index: i, After: copyWallet(wallet)})
+		}
+	}
+	if currencyBefore != b.DefaultCurrency {
+		entry.CurrencyBefore = currencyBefore
+		entry.CurrencyAfter = b.DefaultCurrency
+	}
+	for _, symbol := range slices.Sorted(maps.Keys(b.Prices)) {
+		if old, ok := pricesBefore[symbol]; !ok || old != b.Prices[symbol] {
+			entry.Prices = append(entry.Prices, PriceChange{Symbol: symbol, Before: pricePtr(old, ok), After: pricePtr(b.Prices[symbol], true)})
+		}
+	}
+	for _, symbol := range slices.Sorted(maps.Keys(pricesBefore)) {
+		if _, ok := b.Prices[symbol]; !ok {
+			entry.Prices = append(entry.Prices, PriceChange{Symbol: symbol, Before: pricePtr(pricesBefore[symbol], true)})
+		}
+	}
+	for _, pair := range slices.Sorted(maps.Keys(b.RateOverrides)) {
+		if old, ok := overridesBefore[pair]; !ok || old != b.RateOverrides[pair] {
+			entry.RateOverrides = append(entry.RateOverrides, RateOverrideChange{Pair: pair, Before: overridePtr(old, ok), After: overridePtr(b.RateOverrides[pair], true)})
+		}
+	}
+	for _, pair := range slices.Sorted(maps.Keys(overridesBefore)) {
+		if _, ok := b.RateOverrides[pair]; !ok {
+			entry.RateOverrides = append(entry.RateOverrides, RateOverrideChange{Pair: pair, Before: overridePtr(overridesBefore[pair], true)})
+		}
+	}
+	for i, old := range rulesBefore {
+		index := slices.IndexFunc(b.Recurring, func(r RecurringRule) bool { return r.ID == old.ID })
+		if index < 0 {
+			entry.Recurring = append(entry.Recurring, RecurringChange{ID: old.ID, Index: i, Before: rulePtr(old)})
+		} else if !sameRule(old, b.Recurring[index]) {
+			entry.Recurring = append(entry.Recurring, RecurringChange{ID: old.ID, Index: index, Before: rulePtr(old), After: rulePtr(b.Recurring[index])})
+		}
+	}
+	for i, rule := range b.Recurring {
+		if !slices.ContainsFunc(rulesBefore, func(r RecurringRule) bool { return r.ID == rule.ID }) {
+			entry.Recurring = append(entry.Recurring, RecurringChange{ID: rule.ID, Index: i, After: rulePtr(rule)})
+		}
+	}
+
+	b.Journal = append(b.Journal[:b.JournalPos], entry)
+	if len(b.Journal) > maxJournalEntries {
+		b.Journal = b.Journal[len(b.Journal)-maxJournalEntries:]
+	}
+	b.JournalPos = len(b.Journal)
+	return nil
+}
+
+// revert undoes a change to one wallet. The ledger is append-only, so an
+// edited wallet keeps the entries the change added and gets a set entry back
+// to its old balance.
+func (b *BudgetFile) revert(change WalletChange, description string) error {
+	if change.Before == nil || change.After == nil {
+		b.replace(change.After, change.Before, change.Index)
+		return nil
+	}
+	wallet := b.restoreFields(change.Before)
+	if wallet == nil || len(change.Added) == 0 {
+		return nil
+	}
+
+	tx := Transaction{Amount: change.Before.Balance, Kind: TransactionSet, Memo: "Undo " + description}
+	if change.After.Currency != change.Before.Currency {
+		tx.PreviousCurrency = change.After.Currency
+	}
+	_, err := wallet.record(tx)
+	return err
+}
+
+// reapply redoes a change to one wallet, posting the entries it added again
+func (b *BudgetFile) reapply(change WalletChange) error {
+	if change.Before == nil || change.After == nil {
+		b.replace(change.Before, change.After, change.Index)
+		return nil
+	}
+	wallet := b.restoreFields(change.After)
+	if wallet == nil {
+		return nil
+	}
+
+	for _, tx := range change.Added {
+		tx.Timestamp = time.Time{}
+		if _, err := wallet.record(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreFields sets an edited wallet's fields to a journaled state, keeping
+// its ledger and balance. It returns the wallet, or nil if it is gone.
+func (b *BudgetFile) restoreFields(state *Wallet) *Wallet {
+	index := slices.IndexFunc(b.Wallets, func(w Wallet) bool { return w.ID == state.ID })
+	if index < 0 {
+		return nil
+	}
+	current := &b.Wallets[index]
+	restored := *copyWallet(*state)
+	restored.Transactions, restored.Balance = current.Transactions, current.Balance
+	*current = restored
+	return current
+}
+
+// replace swaps the wallet matching from (by ID) for to, inserting or removing
+// it when either side is nil
+func (b *BudgetFile) replace(from, to *Wallet, index int) {
+	current := -1
+	if from != nil {
+		current = slices.IndexFunc(b.Wallets, func(w Wallet) bool { return w.ID == from.ID })
+	}
+
+	switch {
+	case to == nil && current >= 0:
+		b.Wallets = slices.Delete(b.Wallets, current, current+1)
+	case to != nil && current >= 0:
+		b.Wallets[current] = *copyWallet(*to)
+	case to != nil:
+		index = min(max(index, 0), len(b.Wallets))
+		b.Wallets = slices.Insert(b.Wallets, index, *copyWallet(*to))
+	}
+}
+
+func pricePtr(price Price, ok bool) *Price {
+	if !ok {
+		return nil
+	}
+	return &price
+}
+
+// setPrice restores a manual price to a journaled state
+func (b *BudgetFile) setPrice(symbol string, price *Price) {
+	if price == nil {
+		delete(b.Prices, symbol)
+		return
+	}
+	if b.Prices == nil {
+		b.Prices = make(map[string]Price)
+	}
+	b.Prices[symbol] = *price
+}
+
+func overridePtr(override RateOverride, ok bool) *RateOverride {
+	if !ok {
+		return nil
+	}
+	return &override
+}
+
+// setRateOverride restores an exchange rate override to a journaled state
+func (b *BudgetFile) setRateOverride(pair string, override *RateOverride) {
+	if override == nil {
+		delete(b.RateOverrides, pair)
+		return
+	}
+	if b.RateOverrides == nil {
+		b.RateOverrides = make(RateOverrides)
+	}
+	b.RateOverrides[pair] = *override
+}
+
+func rulePtr(rule RecurringRule) *RecurringRule {
+	return &rule
+}
+
+// sameRule compares two states of a rule, leaving out how far it was posted
+func sameRule(a, b RecurringRule) bool {
+	a.PostedThrough = b.PostedThrough
+	return a == b
+}
+
+// setRecurring restores a recurring rule to a journaled state. How far it was
+// posted stays as it is, so undoing a change never posts a rule twice.
+func (b *BudgetFile) setRecurring(change RecurringChange, rule *RecurringRule) {
+	current := slices.IndexFunc(b.Recurring, func(r RecurringRule) bool { return r.ID == change.ID })
+
+	switch {
+	case rule == nil && current >= 0:
+		b.Recurring = slices.Delete(b.Recurring, current, current+1)
+	case rule != nil && current >= 0:
+		restored := *rule
+		restored.PostedThrough = b.Recurring[current].PostedThrough
+		b.Recurring[current] = restored
+	case rule != nil:
+		index := min(max(change.Index, 0), len(b.Recurring))
+		b.Recurring = slices.Insert(b.Recurring, index, *rule)
+	}
+}
+
+// NextUndo and NextRedo return the entry the next Undo or Redo would apply
+func NextUndo(data *BudgetFile) (JournalEntry, bool) {
+	if data.JournalPos == 0 {
+		return JournalEntry{}, false
+	}
+	return data.Journal[data.JournalPos-1], true
+}
+
+func NextRedo(data *BudgetFile) (JournalEntry, bool) {
+	if data.JournalPos >= len(data.Journal) {
+		return JournalEntry{}, false
+	}
+	return data.Journal[data.JournalPos], true
+}
+
+// Undo reverts the most recent change that hasn't been undone yet
+func Undo(s Store, data *BudgetFile) (JournalEntry, error) {
+	entry, ok := NextUndo(data)
+	if !ok {
+		return JournalEntry{}, fmt.Errorf("nothing to undo")
+	}
+
+	wallets := copyWallets(data.Wallets)
+	for i := len(entry.Changes) - 1; i >= 0; i-- {
+		if err := data.revert(entry.Changes[i], entry.Description); err != nil {
+			data.Wallets = wallets
+			return JournalEntry{}, fmt.Errorf("can't undo %s: %w", entry.Description, err)
+		}
+	}
+	if entry.CurrencyBefore != entry.CurrencyAfter {
+		data.DefaultCurrency = entry.CurrencyBefore
+	}
+	for _, change := range entry.Prices {
+		data.setPrice(change.Symbol, change.Before)
+	}
+	for _, change := range entry.RateOverrides {
+		data.setRateOverride(change.Pair, change.Before)
+	}
+	for i := len(entry.Recurring) - 1; i >= 0; i-- {
+		data.setRecurring(entry.Recurring[i], entry.Recurring[i].Before)
+	}
+	data.JournalPos--
+
+	return entry, s.Save(data)
+}
+
+// Redo applies the most recently undone change again
+func Redo(s Store, data *BudgetFile) (JournalEntry, error) {
+	entry, ok := NextRedo(data)
+	if !ok {
+		return JournalEntry{}, fmt.Errorf("nothing to redo")
+	}
+
+	wallets := copyWallets(data.Wallets)
+	for _, change := range entry.Changes {
+		if err := data.reapply(change); err != nil {
+			data.Wallets = wallets
+			return JournalEntry{}, fmt.Errorf("can't redo %s: %w", entry.Description, err)
+		}
+	}
+	if entry.CurrencyBefore != entry.CurrencyAfter {
+		data.DefaultCurrency = entry.CurrencyAfter
+	}
+	for _, change := range entry.Prices {
+		data.setPrice(change.Symbol, change.After)
+	}
+	for _, change := range entry.RateOverrides {
+		data.setRateOverride(change.Pair, change.After)
+	}
+	for _, change := range entry.Recurring {
+		data.setRecurring(change, change.After)
+	}
+	data.JournalPos++
+
+	return entry, s.Save(data)
+}
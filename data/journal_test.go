@@ -0,0 +1,177 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBudget returns a budget in a memory store with one EUR wallet
+func newTestBudget(t *testing.T) (*MemoryStore, *BudgetFile, string) {
+	t.Helper()
+
+	s := NewMemoryStore()
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget.DefaultCurrency = "EUR"
+	if err := CreateWallet(s, budget, "Checking", "", "", "EUR", NewMoney(10000, 2)); err != nil {
+		t.Fatal(err)
+	}
+	return s, budget, budget.Wallets[0].ID
+}
+
+func TestJournalKeepsOnlyAddedEntries(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	s, budget, id := newTestBudget(t)
+
+	for range 5 {
+		if err := AdjustWallet(s, budget, id, NewMoney(500, 2), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry, _ := NextUndo(budget)
+	if len(entry.Changes) != 1 {
+		t.Fatalf("%d changes, want 1", len(entry.Changes))
+	}
+	change := entry.Changes[0]
+	if change.Before.Transactions != nil || change.After.Transactions != nil {
+		t.Errorf("journal entry keeps the whole ledger")
+	}
+	if len(change.Added) != 1 {
+		t.Errorf("%d added entries, want 1", len(change.Added))
+	}
+
+	// Undo and redo append to the ledger rather than rewrite it
+	tests := []struct {
+		step    func(Store, *BudgetFile) (JournalEntry, error)
+		balance string
+		kind    TransactionKind
+	}{
+		{Undo, "120.00", TransactionSet},
+		{Redo, "125.00", TransactionAdjust},
+	}
+	for i, tt := range tests {
+		if _, err := tt.step(s, budget); err != nil {
+			t.Fatal(err)
+		}
+		wallet := budget.Wallets[0]
+		if want := 7 + i; wallet.Balance.String() != tt.balance || len(wallet.Transactions) != want {
+			t.Errorf("step %d: balance %s with %d entries, want %s with %d", i, wallet.Balance, len(wallet.Transactions), tt.balance, want)
+			continue
+		}
+		if last := wallet.Transactions[len(wallet.Transactions)-1]; last.Kind != tt.kind {
+			t.Errorf("step %d: last entry is %s, want %s", i, last.Kind, tt.kind)
+		}
+		if ledger, err := wallet.LedgerBalance(); err != nil || ledger.Cmp(wallet.Balance) != 0 {
+			t.Errorf("step %d: ledger replays to %s (%v), balance is %s", i, ledger, err, wallet.Balance)
+		}
+	}
+}
+
+func TestUndoDeleteRestoresLedger(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	s, budget, id := newTestBudget(t)
+	if err := AdjustWallet(s, budget, id, NewMoney(500, 2), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteWallet(s, budget, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Undo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if len(budget.Wallets) != 1 || len(budget.Wallets[0].Transactions) != 2 {
+		t.Errorf("deleted wallet not restored with its ledger: %+v", budget.Wallets)
+	}
+}
+
+func TestUndoCurrencyChangeRestoresRules(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	s, budget, id := newTestBudget(t)
+	rule := RecurringRule{WalletID: id, Amount: NewMoney(1000, 2), Cadence: CadenceMonthly}
+	if err := AddRecurringRule(s, budget, rule); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EditWallet(s, budget, id, "Checking", "", "", "USD", true); err != nil {
+		t.Fatal(err)
+	}
+	if budget.Recurring[0].Currency != "EUR" {
+		t.Fatalf("rule currency = %q, want it pinned to EUR", budget.Recurring[0].Currency)
+	}
+
+	if _, err := Undo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if budget.Wallets[0].Currency != "EUR" || budget.Recurring[0].Currency != "" {
+		t.Errorf("after undo: wallet in %s, rule in %q; want EUR and the wallet's currency", budget.Wallets[0].Currency, budget.Recurring[0].Currency)
+	}
+	balance, currency, _, err := budget.Wallets[0].BalanceAt(time.Now().Add(time.Hour))
+	if err != nil || balance.String() != "100.00" || currency != "EUR" {
+		t.Errorf("after undo: ledger replays to %s %s (%v), want 100.00 EUR", balance, currency, err)
+	}
+
+	if _, err := Redo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if budget.Recurring[0].Currency != "EUR" {
+		t.Errorf("after redo: rule currency = %q, want EUR", budget.Recurring[0].Currency)
+	}
+}
+
+func TestMigrateCompactJournal(t *testing.T) {
+	opening := Transaction{Amount: NewMoney(100, 0), Kind: TransactionOpening}
+	deposit := Transaction{Amount: NewMoney(5, 0), Kind: TransactionAdjust}
+	before := Wallet{ID: "w1", Currency: "EUR", Balance: NewMoney(100, 0), Transactions: []Transaction{opening}}
+	after := Wallet{ID: "w1", Currency: "EUR", Balance: NewMoney(105, 0), Transactions: []Transaction{opening, deposit}}
+	budget := &BudgetFile{Journal: []JournalEntry{{Changes: []WalletChange{{Before: &before, After: &after}}}}}
+
+	migrateCompactJournal(budget, "home")
+
+	change := budget.Journal[0].Changes[0]
+	if change.Before.Transactions != nil || change.After.Transactions != nil {
+		t.Errorf("ledgers kept in the journal")
+	}
+	if len(change.Added) != 1 || change.Added[0].Amount.Cmp(deposit.Amount) != 0 {
+		t.Errorf("added = %+v, want the deposit", change.Added)
+	}
+}
+
+func TestUndoRecurringRuleChanges(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	s, budget, id := newTestBudget(t)
+
+	rule := RecurringRule{WalletID: id, Amount: NewMoney(1000, 2), Cadence: CadenceMonthly}
+	if err := AddRecurringRule(s, budget, rule); err != nil {
+		t.Fatal(err)
+	}
+	ruleID := budget.Recurring[0].ID
+	if err := SetRecurringPaused(s, budget, ruleID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRecurringRule(s, budget, ruleID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Undo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if len(budget.Recurring) != 1 || !budget.Recurring[0].Paused {
+		t.Fatalf("undoing the delete: rules = %+v, want the paused rule back", budget.Recurring)
+	}
+	if _, err := Undo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if budget.Recurring[0].Paused {
+		t.Errorf("undoing the pause left the rule paused")
+	}
+	if _, err := Undo(s, budget); err != nil {
+		t.Fatal(err)
+	}
+	if len(budget.Recurring) != 0 {
+		t.Errorf("undoing the add left %d rules", len(budget.Recurring))
+	}
+}
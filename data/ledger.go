@@ -0,0 +1,148 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type TransactionKind string
+
+const (
+	TransactionOpening   TransactionKind = "opening"
+	TransactionAdjust    TransactionKind = "adjust"
+	TransactionSet       TransactionKind = "set"
+	TransactionTransfer  TransactionKind = "transfer"
+	TransactionFee       TransactionKind = "fee"
+	TransactionRecurring TransactionKind = "recurring"
+	TransactionRevalue   TransactionKind = "revalue" // change in the value of holdings
+)
+
+// Transaction is a single entry in a wallet's append-only ledger.
+// For TransactionSet the amount is the new balance, for every other kind
+// it is added to the running balance.
+type Transaction struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Amount    Money           `json:"amount"`
+	Memo      string          `json:"memo,omitempty"`
+	Kind      TransactionKind `json:"kind"`
+
+	// Both legs of a transfer and its fee share a TransferID
+	TransferID   string  `json:"transfer_id,omitempty"`
+	Counterparty string  `json:"counterparty,omitempty"` // ID of the wallet on the other side
+	Rate         float64 `json:"rate,omitempty"`         // units received per unit sent
+	RateSource   string  `json:"rate_source,omitempty"`  // "market", "manual" or "override"
+
+	// Set on the entry that changed the wallet's currency, see EditWallet.
+	// Amounts from there on are in the new currency.
+	PreviousCurrency string `json:"previous_currency,omitempty"`
+}
+
+// LedgerBalance replays the wallet's transactions and returns the resulting balance
+func (w *Wallet) LedgerBalance() (Money, error) {
+	balance := NewMoney(0, CurrencyExponent(w.Currency))
+	for _, tx := range w.Transactions {
+		var err error
+		if balance, err = tx.apply(balance); err != nil {
+			return Money{}, err
+		}
+	}
+	return balance, nil
+}
+
+// BalanceAt replays the transactions dated before a time and returns the
+// balance in the currency the wallet had then. It reports false if the wallet
+// had none by then, i.e. didn't exist yet.
+func (w *Wallet) BalanceAt(before time.Time) (Money, string, bool, error) {
+	// Walk back through the currency changes to find the currency each entry
+	// was recorded in, and the one in use at the time
+	currencies := make([]string, len(w.Transactions))
+	currency, current := w.Currency, w.Currency
+	for i := len(w.Transactions) - 1; i >= 0; i-- {
+		tx := w.Transactions[i]
+		currencies[i] = current
+		if tx.PreviousCurrency == "" {
+			continue
+		}
+		current = tx.PreviousCurrency
+		if !tx.Timestamp.Before(before) {
+			currency = tx.PreviousCurrency
+		}
+	}
+
+	balance := NewMoney(0, CurrencyExponent(currency))
+	existed := false
+	for i, tx := range w.Transactions {
+		// Recurring transactions are posted with their due date, so the ledger
+		// isn't strictly in date order
+		if !tx.Timestamp.Before(before) {
+			continue
+		}
+		existed = true
+		// A back-dated entry posted after a later currency change
+		if currencies[i] != currency {
+			continue
+		}
+		var err error
+		if balance, err = tx.apply(balance); err != nil {
+			return Money{}, "", false, err
+		}
+	}
+	return balance, currency, existed, nil
+}
+
+func (tx Transaction) apply(balance Money) (Money, error) {
+	if tx.Kind == TransactionSet {
+		return tx.Amount, nil
+	}
+	return balance.Add(tx.Amount)
+}
+
+// post appends a transaction to the ledger and updates the stored balance
+func (w *Wallet) post(kind TransactionKind, amount Money, memo string) error {
+	_, err := w.record(Transaction{Amount: amount, Memo: memo, Kind: kind})
+	return err
+}
+
+// record stamps a prepared transaction and posts it. Transactions that
+// already carry a date, like recurring ones, keep it. Nothing is posted if
+// the amount or the new balance is out of range.
+func (w *Wallet) record(tx Transaction) (Transaction, error) {
+	if tx.Timestamp.IsZero() {
+		tx.Timestamp = time.Now()
+	}
+	amount, err := tx.Amount.Rescale(CurrencyExponent(w.Currency))
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx.Amount = amount
+	balance, err := tx.apply(w.Balance)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("balance of '%s': %w", w.Name, err)
+	}
+	w.Transactions = append(w.Transactions, tx)
+	w.Balance = balance
+	return tx, nil
+}
+
+// reconcileLedgers makes sure every wallet's stored balance is backed by its
+// ledger. Balances edited by hand are recorded as a set transaction.
+func reconcileLedgers(budgetFile *BudgetFile) {
+	for i := range budgetFile.Wallets {
+		wallet := &budgetFile.Wallets[i]
+
+		ledgerBalance, err := wallet.LedgerBalance()
+		if err != nil {
+			log.Printf("replaying the ledger of '%s': %v", wallet.Name, err)
+			continue
+		}
+		if ledgerBalance.Cmp(wallet.Balance) != 0 {
+			stored := wallet.Balance
+			wallet.Balance = ledgerBalance
+			if err := wallet.post(TransactionSet, stored, "Balance edited outside the app"); err != nil {
+				log.Printf("recording the balance of '%s': %v", wallet.Name, err)
+				wallet.Balance = stored
+			}
+		}
+	}
+}
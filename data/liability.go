@@ -0,0 +1,88 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Wallet types whose balance is money owed rather than money held. The
+// credit card type is short so it fits the wallet table.
+const (
+	TypeCreditCard = "credit"
+	TypeLoan       = "loan"
+	TypeMortgage   = "mortgage"
+)
+
+var liabilityTypes = map[string]bool{
+	TypeCreditCard: true,
+	"credit card":  true,
+	TypeLoan:       true,
+	TypeMortgage:   true,
+}
+
+// IsLiabilityType reports whether wallets of this type hold debt. Case,
+// dashes and underscores don't matter, so "Credit_Card" counts too.
+func IsLiabilityType(walletType string) bool {
+	normalized := strings.ToLower(strings.TrimSpace(walletType))
+	normalized = strings.NewReplacer("_", " ", "-", " ").Replace(normalized)
+	return liabilityTypes[normalized]
+}
+
+// IsLiability reports whether the wallet's balance is an amount owed
+func (w Wallet) IsLiability() bool {
+	return IsLiabilityType(w.Type)
+}
+
+// NetWorth returns what the wallet adds to net worth: its balance, or the
+// balance taken away for a liability
+func (w Wallet) NetWorth() Money {
+	if w.IsLiability() {
+		return w.Balance.Neg()
+	}
+	return w.Balance
+}
+
+// Utilization returns the share of the credit limit in use, if the wallet has a limit
+func (w Wallet) Utilization() (float64, bool) {
+	if w.CreditLimit == nil || w.CreditLimit.Sign() <= 0 {
+		return 0, false
+	}
+	return w.Balance.Float64() / w.CreditLimit.Float64(), true
+}
+
+// SetCreditLimit sets the credit limit of a liability wallet. A zero limit removes it.
+func SetCreditLimit(s Store, data *BudgetFile, id string, limit Money) error {
+	index, err := FindWallet(data, id)
+	if err != nil {
+		return err
+	}
+
+	wallet := &data.Wallets[index]
+	if !wallet.IsLiability() {
+		return fmt.Errorf("'%s' is a %s wallet; only credit cards, loans and mortgages have a credit limit", wallet.Name, wallet.Type)
+	}
+	if limit.Sign() < 0 {
+		return fmt.Errorf("credit limit can't be negative")
+	}
+
+	description := fmt.Sprintf("remove the credit limit of '%s'", wallet.Name)
+	if !limit.IsZero() {
+		description = fmt.Sprintf("set the credit limit of '%s' to %s", wallet.Name, limit)
+	}
+	limit, err = limit.Rescale(CurrencyExponent(wallet.Currency))
+	if err != nil {
+		return fmt.Errorf("invalid credit limit: %w", err)
+	}
+	err = data.journal(description, func() error {
+		if limit.IsZero() {
+			wallet.CreditLimit = nil
+		} else {
+			wallet.CreditLimit = &limit
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
@@ -0,0 +1,181 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps budgets in memory. Budgets are stored encoded, so callers
+// never share state with the store, just like with the file-backed stores.
+type MemoryStore struct {
+	mu      sync.Mutex
+	budgets map[string][]byte
+	keys    keyring
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{budgets: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) List() ([]BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var budgetFiles []BudgetFile
+	for slug, content := range s.budgets {
+		budgetFile, _, _, err := loadBudget(content, slug, s.keys.get(slug))
+		if err != nil {
+			return nil, err
+		}
+		budgetFiles = append(budgetFiles, *budgetFile)
+	}
+
+	sortByUpdated(budgetFiles)
+
+	return budgetFiles, nil
+}
+
+func (s *MemoryStore) Load(slug string) (*BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, exists := s.budgets[slug]
+	if !exists {
+		return nil, fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	budgetFile, _, _, err := loadBudget(content, slug, s.keys.get(slug))
+	if err != nil {
+		return nil, err
+	}
+	return requireUnlocked(budgetFile)
+}
+
+func (s *MemoryStore) Create(name string) (*BudgetFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	budgetFile, err := newBudgetFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := s.budgets[budgetFile.Slug]; exists {
+		return nil, fmt.Errorf("a budget is already stored as '%s'", budgetFile.Slug)
+	}
+
+	if err := s.put(budgetFile); err != nil {
+		return nil, err
+	}
+
+	return budgetFile, nil
+}
+
+func (s *MemoryStore) Save(budgetFile *BudgetFile) error {
+	return s.save(budgetFile, false)
+}
+
+func (s *MemoryStore) ForceSave(budgetFile *BudgetFile) error {
+	return s.save(budgetFile, true)
+}
+
+func (s *MemoryStore) save(budgetFile *BudgetFile, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var storedRevision int64
+	var storedVersion int
+	if content, exists := s.budgets[budgetFile.Slug]; exists {
+		revision, version, err := readRevision(content)
+		if err != nil {
+			return err
+		}
+		storedRevision, storedVersion = revision, version
+	}
+
+	if err := prepareSave(budgetFile, storedRevision, storedVersion, force); err != nil {
+		return err
+	}
+
+	return s.put(budgetFile)
+}
+
+func (s *MemoryStore) put(budgetFile *BudgetFile) error {
+	content, err := encodeBudgetFile(budgetFile)
+	if err != nil {
+		return err
+	}
+	s.budgets[budgetFile.Slug] = content
+	s.keys.remember(budgetFile)
+	return nil
+}
+
+func (s *MemoryStore) Delete(slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.budgets[slug]; !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	delete(s.budgets, slug)
+	s.keys.forget(slug)
+	return nil
+}
+
+func (s *MemoryStore) Rename(slug, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ValidateBudgetName(newName); err != nil {
+		return err
+	}
+	newName = strings.TrimSpace(newName)
+	newSlug := Slugify(newName)
+
+	content, exists := s.budgets[slug]
+	if !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+	if _, exists := s.budgets[newSlug]; exists && newSlug != slug {
+		return fmt.Errorf("a budget is already stored as '%s'", newSlug)
+	}
+
+	budgetFile, fromVersion, _, err := loadBudget(content, slug, s.keys.get(slug))
+	if err != nil {
+		return err
+	}
+
+	budgetFile.Name = newName
+	budgetFile.Slug = newSlug
+	if err := prepareSave(budgetFile, budgetFile.Revision, fromVersion, false); err != nil {
+		return err
+	}
+	if err := s.put(budgetFile); err != nil {
+		return err
+	}
+
+	if newSlug != slug {
+		delete(s.budgets, slug)
+		s.keys.forget(slug)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Unlock(slug, passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, exists := s.budgets[slug]
+	if !exists {
+		return fmt.Errorf("budget '%s' does not exist", slug)
+	}
+
+	key, err := unlockBudget(content, passphrase)
+	if err != nil {
+		return err
+	}
+	s.keys.set(slug, key)
+
+	return nil
+}
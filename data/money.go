@@ -0,0 +1,305 @@
+package data
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact decimal amount stored as an integer number of minor units
+// together with its decimal exponent, so 12.50 is 1250 with exponent 2.
+// It is written to JSON as a decimal string to avoid float rounding.
+type Money struct {
+	units int64
+	exp   int
+}
+
+const defaultExponent = 2
+
+// ErrOutOfRange is returned when an amount or the result of arithmetic on
+// amounts has more minor units than Money can hold
+var ErrOutOfRange = errors.New("amount is out of range")
+
+// CurrencyExponent returns the number of decimal places amounts in the
+// given currency or unit are stored with, see LookupUnit.
+func CurrencyExponent(currency string) int {
+	unit, err := LookupUnit(currency)
+	if err != nil {
+		return defaultExponent
+	}
+	return unit.Precision
+}
+
+func NewMoney(units int64, exp int) Money {
+	return Money{units: units, exp: exp}
+}
+
+// ParseMoney parses a decimal string such as "12.5", "+100" or "-0.25" and
+// rounds it to the given exponent.
+func ParseMoney(s string, exp int) (Money, error) {
+	m, err := parseDecimal(s)
+	if err != nil {
+		return Money{}, err
+	}
+	m, err = m.Rescale(exp)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: '%s'", err, strings.TrimSpace(s))
+	}
+	return m, nil
+}
+
+// parseDecimal parses a decimal string keeping every digit it was given
+func parseDecimal(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	original := s
+
+	negative := false
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	// Accept exponent notation from legacy float values such as 1e-7
+	if strings.ContainsAny(s, "eE") {
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return Money{}, fmt.Errorf("invalid amount '%s'", original)
+		}
+		s = r.FloatString(18)
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Money{}, fmt.Errorf("invalid amount '%s'", original)
+	}
+	for _, char := range intPart + fracPart {
+		if char < '0' || char > '9' {
+			return Money{}, fmt.Errorf("invalid amount '%s'", original)
+		}
+	}
+
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if digits == "" {
+		digits = "0"
+	}
+	exp := len(fracPart)
+	units, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		// Too many digits for int64: drop the least significant decimals
+		exp -= len(digits) - 18
+		if exp < 0 {
+			return Money{}, fmt.Errorf("%w: '%s'", ErrOutOfRange, original)
+		}
+		r, _ := new(big.Rat).SetString(intPart + "." + fracPart)
+		m, err := moneyFromRat(r, exp)
+		if err != nil {
+			return Money{}, fmt.Errorf("%w: '%s'", err, original)
+		}
+		units = m.units
+	}
+	if negative {
+		units = -units
+	}
+
+	return Money{units: units, exp: exp}, nil
+}
+
+// ParseQuantity parses a non-negative decimal such as a number of shares,
+// keeping every digit it was given
+func ParseQuantity(s string) (Money, error) {
+	m, err := parseDecimal(s)
+	if err != nil {
+		return Money{}, err
+	}
+	if m.Sign() < 0 {
+		return Money{}, fmt.Errorf("quantity can't be negative")
+	}
+	return m, nil
+}
+
+// MoneyFromFloat converts a float to Money, rounding to the given exponent
+func MoneyFromFloat(f float64, exp int) (Money, error) {
+	return moneyFromRat(new(big.Rat).SetFloat64(f), exp)
+}
+
+func moneyFromRat(r *big.Rat, exp int) (Money, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(exp)))
+
+	// Round half away from zero
+	num := new(big.Int).Abs(scaled.Num())
+	quo, rem := new(big.Int).QuoRem(num, scaled.Denom(), new(big.Int))
+	if new(big.Int).Mul(rem, big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if scaled.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	if !quo.IsInt64() {
+		return Money{}, ErrOutOfRange
+	}
+
+	return Money{units: quo.Int64(), exp: exp}, nil
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
+
+func (m Money) Units() int64 {
+	return m.units
+}
+
+func (m Money) Exp() int {
+	return m.exp
+}
+
+func (m Money) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.units), pow10(m.exp))
+}
+
+// Float64 returns the nearest float, for display maths only
+func (m Money) Float64() float64 {
+	f, _ := m.rat().Float64()
+	return f
+}
+
+// Rescale returns the amount with the given exponent, rounding if precision
+// is lost. Adding decimals fails if the amount no longer fits.
+func (m Money) Rescale(exp int) (Money, error) {
+	if exp == m.exp {
+		return m, nil
+	}
+	if exp > m.exp {
+		units := new(big.Int).Mul(big.NewInt(m.units), pow10(exp-m.exp))
+		if !units.IsInt64() {
+			return Money{}, ErrOutOfRange
+		}
+		return Money{units: units.Int64(), exp: exp}, nil
+	}
+	return moneyFromRat(m.rat(), exp)
+}
+
+func (m Money) align(other Money) (Money, Money, error) {
+	if m.exp > other.exp {
+		other, err := other.Rescale(m.exp)
+		return m, other, err
+	}
+	m, err := m.Rescale(other.exp)
+	return m, other, err
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	a, b, err := m.align(other)
+	if err != nil {
+		return Money{}, err
+	}
+	if (b.units > 0 && a.units > math.MaxInt64-b.units) || (b.units < 0 && a.units < math.MinInt64-b.units) {
+		return Money{}, ErrOutOfRange
+	}
+	return Money{units: a.units + b.units, exp: a.exp}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.units == math.MinInt64 {
+		return Money{}, ErrOutOfRange
+	}
+	return m.Add(other.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{units: -m.units, exp: m.exp}
+}
+
+// MulRate multiplies the amount by a rate and rounds the result to exp
+func (m Money) MulRate(rate float64, exp int) (Money, error) {
+	return moneyFromRat(new(big.Rat).Mul(m.rat(), new(big.Rat).SetFloat64(rate)), exp)
+}
+
+// Mul multiplies two amounts, such as a quantity by a price, and rounds the result to exp
+func (m Money) Mul(other Money, exp int) (Money, error) {
+	return moneyFromRat(new(big.Rat).Mul(m.rat(), other.rat()), exp)
+}
+
+// DivRate divides the amount by a rate and rounds the result to exp
+func (m Money) DivRate(rate float64, exp int) (Money, error) {
+	return moneyFromRat(new(big.Rat).Quo(m.rat(), new(big.Rat).SetFloat64(rate)), exp)
+}
+
+// signPrefix returns "+" for amounts that String prints without a sign
+func signPrefix(m Money) string {
+	if m.Sign() >= 0 {
+		return "+"
+	}
+	return ""
+}
+
+// Cmp compares two amounts and returns -1, 0 or +1
+func (m Money) Cmp(other Money) int {
+	if m.exp == other.exp {
+		return cmp.Compare(m.units, other.units)
+	}
+	return m.rat().Cmp(other.rat())
+}
+
+func (m Money) Sign() int {
+	switch {
+	case m.units < 0:
+		return -1
+	case m.units > 0:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) IsZero() bool {
+	return m.units == 0
+}
+
+func (m Money) String() string {
+	units := m.units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	digits := strconv.FormatInt(units, 10)
+	if m.exp <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= m.exp {
+		digits = strings.Repeat("0", m.exp-len(digits)+1) + digits
+	}
+
+	point := len(digits) - m.exp
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts decimal strings as well as the plain JSON numbers
+// older budget files stored balances as.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var number json.Number
+		if err := json.Unmarshal(b, &number); err != nil {
+			return fmt.Errorf("amount must be a decimal string or number: %v", err)
+		}
+		s = number.String()
+	}
+
+	parsed, err := parseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
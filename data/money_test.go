@@ -0,0 +1,202 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		exp     int
+		want    string
+		wantErr bool
+	}{
+		{"12.5", 2, "12.50", false},
+		{"+100", 2, "100.00", false},
+		{"-0.25", 2, "-0.25", false},
+		{"0.005", 2, "0.01", false},
+		{"-0.005", 2, "-0.01", false},
+		{"1234.5", 0, "1235", false},
+		{"1.23456789", 8, "1.23456789", false},
+		{"1e-7", 8, "0.00000010", false},
+		{".5", 2, "0.50", false},
+		{"", 2, "", true},
+		{".", 2, "", true},
+		{"1.2.3", 2, "", true},
+		{"12a", 2, "", true},
+		{"99999999999999999999999", 2, "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, tt.exp)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q, %d) = %s, want an error", tt.in, tt.exp, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %d): %v", tt.in, tt.exp, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseMoney(%q, %d) = %s, want %s", tt.in, tt.exp, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyStringRoundTrip(t *testing.T) {
+	for _, m := range []Money{
+		NewMoney(0, 2),
+		NewMoney(5, 2),
+		NewMoney(-5, 2),
+		NewMoney(123456, 2),
+		NewMoney(-1, 8),
+		NewMoney(1500, 3),
+		NewMoney(42, 0),
+	} {
+		parsed, err := parseDecimal(m.String())
+		if err != nil {
+			t.Errorf("parseDecimal(%q): %v", m.String(), err)
+			continue
+		}
+		if parsed != m {
+			t.Errorf("%s came back as %s (exp %d, want %d)", m, parsed, parsed.Exp(), m.Exp())
+		}
+	}
+}
+
+func TestMoneyRescale(t *testing.T) {
+	tests := []struct {
+		m    Money
+		exp  int
+		want string
+	}{
+		{NewMoney(1250, 2), 0, "13"},
+		{NewMoney(-1250, 2), 0, "-13"},
+		{NewMoney(1249, 2), 1, "12.5"},
+		{NewMoney(5, 0), 3, "5.000"},
+		{NewMoney(12345, 3), 2, "12.35"},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Rescale(tt.exp)
+		if err != nil {
+			t.Errorf("%s.Rescale(%d): %v", tt.m, tt.exp, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s.Rescale(%d) = %s, want %s", tt.m, tt.exp, got, tt.want)
+		}
+	}
+
+	// Scaling up and back down loses nothing
+	m := NewMoney(-98765, 2)
+	up, err := m.Rescale(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back, err := up.Rescale(2); err != nil || back != m {
+		t.Errorf("%s came back as %s (%v)", m, back, err)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, b := NewMoney(1050, 2), NewMoney(25, 1)
+	if got, err := a.Add(b); err != nil || got.String() != "13.00" {
+		t.Errorf("10.50 + 2.5 = %s (%v)", got, err)
+	}
+	if got, err := a.Sub(b); err != nil || got.String() != "8.00" {
+		t.Errorf("10.50 - 2.5 = %s (%v)", got, err)
+	}
+	if a.Cmp(b) != 1 || b.Cmp(a) != -1 || NewMoney(250, 2).Cmp(b) != 0 {
+		t.Errorf("Cmp doesn't align exponents")
+	}
+	if got, err := NewMoney(10000, 2).MulRate(1.08, 2); err != nil || got.String() != "108.00" {
+		t.Errorf("100.00 * 1.08 = %s (%v)", got, err)
+	}
+	if got, err := NewMoney(10, 0).Mul(NewMoney(11230, 2), 2); err != nil || got.String() != "1123.00" {
+		t.Errorf("10 * 112.30 = %s (%v)", got, err)
+	}
+}
+
+func TestMoneyLimits(t *testing.T) {
+	largest := NewMoney(math.MaxInt64, 2)
+	smallest := NewMoney(math.MinInt64, 2)
+
+	tests := []struct {
+		name string
+		op   func() (Money, error)
+	}{
+		{"parse past the precision", func() (Money, error) { return ParseMoney("99999999999999999", 8) }},
+		{"parse past int64", func() (Money, error) { return ParseMoney("92233720368547758.08", 2) }},
+		{"parse a negative past int64", func() (Money, error) { return ParseMoney("-92233720368547758.09", 2) }},
+		{"rescale up", func() (Money, error) { return NewMoney(math.MaxInt64/10+1, 0).Rescale(1) }},
+		{"add", func() (Money, error) { return largest.Add(NewMoney(1, 2)) }},
+		{"add with rescale", func() (Money, error) { return NewMoney(1, 0).Add(largest) }},
+		{"add negatives", func() (Money, error) { return smallest.Add(NewMoney(-1, 2)) }},
+		{"subtract", func() (Money, error) { return smallest.Sub(NewMoney(1, 2)) }},
+		{"subtract the smallest", func() (Money, error) { return NewMoney(0, 2).Sub(smallest) }},
+		{"multiply by a rate", func() (Money, error) { return largest.MulRate(2, 2) }},
+		{"multiply", func() (Money, error) { return largest.Mul(NewMoney(2, 0), 2) }},
+		{"divide by a rate", func() (Money, error) { return largest.DivRate(0.5, 2) }},
+		{"convert a float", func() (Money, error) { return MoneyFromFloat(1e18, 2) }},
+	}
+	for _, tt := range tests {
+		got, err := tt.op()
+		if !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s = %s, %v; want ErrOutOfRange", tt.name, got, err)
+		}
+	}
+
+	// The extremes themselves are fine
+	if got, err := ParseMoney("92233720368547758.07", 2); err != nil || got != largest {
+		t.Errorf("ParseMoney at the limit = %s, %v", got, err)
+	}
+	if got, err := largest.Add(smallest); err != nil || got.String() != "-0.01" {
+		t.Errorf("largest + smallest = %s, %v", got, err)
+	}
+	if got, err := ParseAmount("92,233,720,368,547,758.08", "USD"); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("ParseAmount past int64 = %s, %v; want ErrOutOfRange", got, err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var wallet struct {
+		Balance Money `json:"balance"`
+	}
+	for _, in := range []string{`{"balance": "12.50"}`, `{"balance": 12.5}`} {
+		if err := json.Unmarshal([]byte(in), &wallet); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if balance, _ := wallet.Balance.Rescale(2); balance.String() != "12.50" {
+			t.Errorf("%s decoded as %s", in, wallet.Balance)
+		}
+	}
+
+	out, err := json.Marshal(NewMoney(-1250, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `"-12.50"` {
+		t.Errorf("marshaled as %s, want \"-12.50\"", out)
+	}
+}
+
+func TestAdjustOutOfRangeChangesNothing(t *testing.T) {
+	useTestHome(t, &stubRates{})
+	s, budget, id := newTestBudget(t)
+
+	err := AdjustWallet(s, budget, id, NewMoney(math.MaxInt64, 2), "")
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Fatalf("AdjustWallet past int64 = %v, want ErrOutOfRange", err)
+	}
+	wallet := budget.Wallets[0]
+	if wallet.Balance.String() != "100.00" || len(wallet.Transactions) != 1 {
+		t.Errorf("wallet changed to %s with %d entries", wallet.Balance, len(wallet.Transactions))
+	}
+	if len(budget.Journal) != 1 {
+		t.Errorf("%d journal entries, want 1", len(budget.Journal))
+	}
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxBudgetNameLength = 64
+
+// reservedNames are device names Windows won't open as files, whatever the
+// extension, so "con.json" can't hold a budget
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// isReservedName reports whether Windows reserves the part of name before its first dot
+func isReservedName(name string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(name), ".")
+	return reservedNames[strings.TrimSpace(base)]
+}
+
+// ValidateBudgetName checks a display name typed by the user. Any printable
+// name is allowed as long as it leaves something to build a file name from.
+func ValidateBudgetName(name string) error {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return fmt.Errorf("budget name can't be empty")
+	}
+	if utf8.RuneCountInString(name) > maxBudgetNameLength {
+		return fmt.Errorf("budget name can be at most %d characters", maxBudgetNameLength)
+	}
+	for _, char := range name {
+		if !unicode.IsPrint(char) {
+			return fmt.Errorf("budget name can't contain control characters")
+		}
+	}
+	if Slugify(name) == "" {
+		return fmt.Errorf("budget name must contain at least one letter or digit")
+	}
+
+	return nil
+}
+
+// Slugify turns a display name into the name a budget is stored under:
+// lowercase ASCII letters, digits and dashes, e.g. "Family / 2024" becomes "family-2024".
+// Names Windows reserves get a suffix so budgets can move between systems:
+// "Con" becomes "con-budget".
+func Slugify(name string) string {
+	var slug strings.Builder
+	pendingDash := false
+
+	for _, char := range strings.ToLower(name) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') {
+			if pendingDash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(char)
+			pendingDash = false
+		} else {
+			pendingDash = true
+		}
+		if slug.Len() >= maxBudgetNameLength {
+			break
+		}
+	}
+
+	if isReservedName(slug.String()) {
+		slug.WriteString("-budget")
+	}
+	return slug.String()
+}
+
+// checkSlug makes sure a store key can't escape the store's directory. Keys
+// from older versions may contain spaces and other characters, so this only
+// rejects what's unsafe rather than requiring Slugify's output. Reserved
+// names are only unsafe on Windows, where they open a device.
+func checkSlug(slug string) error {
+	if slug == "" || slug == "." || slug == ".." ||
+		strings.HasPrefix(slug, ".") ||
+		strings.ContainsAny(slug, `/\:`) ||
+		filepath.Base(slug) != slug ||
+		(runtime.GOOS == "windows" && isReservedName(slug)) {
+		return fmt.Errorf("invalid budget file name '%s'", slug)
+	}
+	for _, char := range slug {
+		if !unicode.IsPrint(char) {
+			return fmt.Errorf("invalid budget file name '%s'", slug)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Family / 2024", "family-2024"},
+		{"  Trip  to   Rome  ", "trip-to-rome"},
+		{"../../etc/passwd", "etc-passwd"},
+		{`C:\budgets\home`, "c-budgets-home"},
+		{".hidden", "hidden"},
+		{"Café Crème", "caf-cr-me"},
+		{"Ünïcödé 2", "n-c-d-2"},
+		{"日本の予算", ""},
+		{"", ""},
+		{"---", ""},
+		// Windows device names get a suffix
+		{"Con", "con-budget"},
+		{"NUL", "nul-budget"},
+		{"com1", "com1-budget"},
+		{"lpt9", "lpt9-budget"},
+		{"Console", "console"},
+		{"com10", "com10"},
+		{strings.Repeat("ab", 40), strings.Repeat("ab", 32)},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.name); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := Slugify(tt.name); got != "" && checkSlug(got) != nil {
+			t.Errorf("Slugify(%q) = %q, which checkSlug rejects", tt.name, got)
+		}
+	}
+}
+
+func TestCheckSlug(t *testing.T) {
+	tests := []struct {
+		slug    string
+		wantErr bool
+	}{
+		{"family-2024", false},
+		// Keys from before slugs keep working
+		{"My Budget", false},
+		{"café", false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{".hidden", true},
+		{"../home", true},
+		{"a/b", true},
+		{`a\b`, true},
+		{"c:home", true},
+		{"tab\there", true},
+		{"con", runtime.GOOS == "windows"},
+		{"Aux.old", runtime.GOOS == "windows"},
+		{"con-budget", false},
+	}
+	for _, tt := range tests {
+		if err := checkSlug(tt.slug); (err != nil) != tt.wantErr {
+			t.Errorf("checkSlug(%q) = %v, want error %v", tt.slug, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBudgetNameCollisions(t *testing.T) {
+	s := NewMemoryStore()
+	if _, err := s.Create("Family 2024"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names that differ only in case and punctuation share a slug
+	for _, name := range []string{"family-2024", "FAMILY / 2024", " Family  2024 "} {
+		if _, err := s.Create(name); err == nil {
+			t.Errorf("Create(%q) succeeded alongside 'Family 2024'", name)
+		}
+	}
+	if _, err := s.Create("Family 2025"); err != nil {
+		t.Errorf("Create('Family 2025'): %v", err)
+	}
+
+	for _, name := range []string{"", "   ", "日本の予算", "!!!", "tab\there", strings.Repeat("x", maxBudgetNameLength+1)} {
+		if err := ValidateBudgetName(name); err == nil {
+			t.Errorf("ValidateBudgetName(%q) succeeded", name)
+		}
+	}
+}
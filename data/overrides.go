@@ -0,0 +1,185 @@
+package data
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RateOverride is an exchange rate fixed by hand for one budget, such as the
+// rate a bank actually gave or one for a currency the APIs don't cover: one
+// From buys Rate of To
+type RateOverride struct {
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Rate  float64   `json:"rate"`
+	SetAt time.Time `json:"set_at"`
+}
+
+// RateOverrides are a budget's overrides keyed by pairKey. They apply in both
+// directions and win over the rate providers for their own pair, see resolve.
+type RateOverrides map[string]RateOverride
+
+func pairKey(from, to string) string {
+	return from + "/" + to
+}
+
+// lookup returns the override between two units, inverting it if it was set
+// the other way round
+func (o RateOverrides) lookup(from, to string) (float64, bool) {
+	if override, ok := o[pairKey(from, to)]; ok {
+		return override.Rate, true
+	}
+	if override, ok := o[pairKey(to, from)]; ok {
+		return 1 / override.Rate, true
+	}
+	return 0, false
+}
+
+// resolve returns the rate between two units and whether an override set it.
+// An override of the pair itself wins over the market. Otherwise the market
+// rate is used, and only a pair the market can't price is bridged through an
+// override: ARS to EUR with only USD/ARS overridden and no ARS rate available
+// goes ARS to USD by the override, then USD to EUR at market.
+func (o RateOverrides) resolve(from, to, base string, day time.Time, fetch bool) (float64, bool, error) {
+	if from == to {
+		return 1, false, nil
+	}
+	if rate, ok := o.lookup(from, to); ok {
+		return rate, true, nil
+	}
+
+	rate, err := marketRate(from, to, base, day, fetch)
+	if err == nil || len(o) == 0 {
+		return rate, false, err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(o)) {
+		override := o[key]
+		for _, bridge := range []string{override.From, override.To} {
+			if bridge == from || bridge == to {
+				continue
+			}
+			if first, ok := o.lookup(from, bridge); ok {
+				if second, err := marketRate(bridge, to, base, day, fetch); err == nil {
+					return first * second, true, nil
+				}
+			}
+			if second, ok := o.lookup(bridge, to); ok {
+				if first, err := marketRate(from, bridge, base, day, fetch); err == nil {
+					return first * second, true, nil
+				}
+			}
+		}
+	}
+	return 0, false, err
+}
+
+// Applies reports whether converting between two units uses an override
+func (o RateOverrides) Applies(from, to, base string) bool {
+	_, overridden, err := o.resolve(from, to, base, time.Time{}, true)
+	return err == nil && overridden
+}
+
+// source names where the rate between two units comes from, for the ledger
+func (o RateOverrides) source(from, to, base string) string {
+	if o.Applies(from, to, base) {
+		return RateSourceOverride
+	}
+	return RateSourceMarket
+}
+
+// Sorted returns the overrides ordered by pair
+func (o RateOverrides) Sorted() []RateOverride {
+	overrides := make([]RateOverride, 0, len(o))
+	for _, key := range slices.Sorted(maps.Keys(o)) {
+		overrides = append(overrides, o[key])
+	}
+	return overrides
+}
+
+// SetRateOverride fixes the rate between two units for this budget, replacing
+// an override of the pair in either direction, and revalues holdings priced
+// in another currency
+func SetRateOverride(s Store, data *BudgetFile, from, to string, rate float64, prices PriceProvider) error {
+	fromUnit, err := LookupUnit(from)
+	if err != nil {
+		return err
+	}
+	toUnit, err := LookupUnit(to)
+	if err != nil {
+		return err
+	}
+	if fromUnit.Code == toUnit.Code {
+		return fmt.Errorf("can't set a rate from %s to itself", fromUnit.Code)
+	}
+	if rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+
+	description := fmt.Sprintf("rate %s %s %s", fromUnit.Code, toUnit.Code, strconv.FormatFloat(rate, 'f', -1, 64))
+	err = data.journal(description, func() error {
+		if data.RateOverrides == nil {
+			data.RateOverrides = make(RateOverrides)
+		}
+		delete(data.RateOverrides, pairKey(toUnit.Code, fromUnit.Code))
+		data.RateOverrides[pairKey(fromUnit.Code, toUnit.Code)] = RateOverride{
+			From:  fromUnit.Code,
+			To:    toUnit.Code,
+			Rate:  rate,
+			SetAt: time.Now(),
+		}
+		_, _, err := revalueHoldings(data, prices)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
+
+// ClearRateOverride removes the override between two units, in whichever
+// direction it was set. Empty from and to clear every override.
+func ClearRateOverride(s Store, data *BudgetFile, from, to string, prices PriceProvider) error {
+	if len(data.RateOverrides) == 0 {
+		return fmt.Errorf("no exchange rate overrides are set")
+	}
+
+	description := "clear rate overrides"
+	var keys []string
+	if from == "" && to == "" {
+		keys = slices.Collect(maps.Keys(data.RateOverrides))
+	} else {
+		fromUnit, err := LookupUnit(from)
+		if err != nil {
+			return err
+		}
+		toUnit, err := LookupUnit(to)
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{pairKey(fromUnit.Code, toUnit.Code), pairKey(toUnit.Code, fromUnit.Code)} {
+			if _, ok := data.RateOverrides[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("no override is set between %s and %s", fromUnit.Code, toUnit.Code)
+		}
+		description = fmt.Sprintf("clear rate %s %s", fromUnit.Code, toUnit.Code)
+	}
+
+	err := data.journal(description, func() error {
+		for _, key := range keys {
+			delete(data.RateOverrides, key)
+		}
+		_, _, err := revalueHoldings(data, prices)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOverrideLeavesOtherMarketPairsAlone(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25, "GBP": 0.8}})
+	overrides := RateOverrides{pairKey("USD", "ARS"): {From: "USD", To: "ARS", Rate: 1050}}
+
+	rate, err := ExchangeRate("USD", "EUR", "EUR", overrides)
+	if err != nil {
+		t.Fatalf("USD to EUR: %v", err)
+	}
+	if math.Abs(rate-0.8) > 1e-9 {
+		t.Errorf("USD to EUR = %v, want the market rate 0.8", rate)
+	}
+	if overrides.Applies("USD", "EUR", "EUR") {
+		t.Errorf("USD to EUR reported as using an override")
+	}
+}
+
+func TestOverrideBridgesPairsTheMarketLacks(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+	overrides := RateOverrides{pairKey("USD", "ARS"): {From: "USD", To: "ARS", Rate: 1000}}
+
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"USD", "ARS", 1000},
+		{"ARS", "USD", 0.001},
+		{"ARS", "EUR", 0.0008},
+		{"EUR", "ARS", 1250},
+	}
+	for _, tt := range tests {
+		rate, err := ExchangeRate(tt.from, tt.to, "EUR", overrides)
+		if err != nil {
+			t.Errorf("%s to %s: %v", tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(rate-tt.want) > 1e-9*tt.want {
+			t.Errorf("%s to %s = %v, want %v", tt.from, tt.to, rate, tt.want)
+		}
+		if !overrides.Applies(tt.from, tt.to, "EUR") {
+			t.Errorf("%s to %s not reported as using an override", tt.from, tt.to)
+		}
+	}
+}
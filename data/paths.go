@@ -0,0 +1,255 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const appDirName = "the-terminal-budget"
+
+// Paths are the directories the app keeps its files in
+type Paths struct {
+	ConfigDir string // config.json and prices.csv
+	DataDir   string // budget files and the rate history, shared between users if pointed at a shared folder
+	CacheDir  string // exchange rate cache and log
+}
+
+// Config is read from config.json in the config directory
+type Config struct {
+	// DataDir points every user at the same budgets folder, e.g. a team share
+	DataDir  string         `json:"data_dir,omitempty"`
+	Currency CurrencyConfig `json:"currency"`
+	// PriceFile overrides where holdings are priced from, see PriceFile
+	PriceFile string `json:"price_file,omitempty"`
+}
+
+var (
+	paths      Paths
+	config     Config
+	configured bool
+)
+
+// Configure resolves where the app keeps its files and loads config.json.
+// dataDir comes from the --data-dir flag and wins over everything else when set.
+//
+// Without a flag, BUDGET_HOME keeps everything in one folder using the layout of
+// ~/.budget; otherwise the XDG base directories are used.
+func Configure(dataDir string) (Paths, error) {
+	resolved, err := resolvePaths()
+	if err != nil {
+		return Paths{}, err
+	}
+
+	cfg, err := loadConfig(resolved.ConfigDir)
+	if err != nil {
+		return Paths{}, err
+	}
+
+	if cfg.DataDir != "" {
+		resolved.DataDir = expandHome(cfg.DataDir)
+	}
+	if dataDir != "" {
+		resolved.DataDir = expandHome(dataDir)
+	}
+
+	paths = resolved
+	config = cfg
+	configured = true
+	SetOffline(cfg.Currency.Offline)
+	return paths, nil
+}
+
+// CurrentPaths returns the configured directories, resolving the defaults
+// if Configure has not been called.
+func CurrentPaths() Paths {
+	if !configured {
+		if resolved, err := resolvePaths(); err == nil {
+			paths = resolved
+			configured = true
+		}
+	}
+	return paths
+}
+
+func resolvePaths() (Paths, error) {
+	if budgetHome := os.Getenv("BUDGET_HOME"); budgetHome != "" {
+		budgetHome = expandHome(budgetHome)
+		return Paths{
+			ConfigDir: budgetHome,
+			DataDir:   filepath.Join(budgetHome, "files"),
+			CacheDir:  budgetHome,
+		}, nil
+	}
+	return xdgPaths()
+}
+
+// xdgPaths returns the default directories under the XDG base directories
+func xdgPaths() (Paths, error) {
+	configHome, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return Paths{}, err
+	}
+	dataHome, err := xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	if err != nil {
+		return Paths{}, err
+	}
+	cacheHome, err := xdgDir("XDG_CACHE_HOME", ".cache")
+	if err != nil {
+		return Paths{}, err
+	}
+
+	return Paths{
+		ConfigDir: filepath.Join(configHome, appDirName),
+		DataDir:   filepath.Join(dataHome, appDirName, "budgets"),
+		CacheDir:  filepath.Join(cacheHome, appDirName),
+	}, nil
+}
+
+// xdgDir returns an XDG base directory, falling back to its default under the home directory
+func xdgDir(envVar, fallback string) (string, error) {
+	// The spec says relative paths must be ignored
+	if dir := os.Getenv(envVar); dir != "" && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find home directory, set BUDGET_HOME or use --data-dir: %v", err)
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || len(path) > 1 && path[:2] == "~"+string(filepath.Separator) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func loadConfig(configDir string) (Config, error) {
+	var cfg Config
+
+	file, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal(file, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %v", filepath.Join(configDir, "config.json"), err)
+	}
+
+	return cfg, nil
+}
+
+// MigrateLegacyHome moves budgets and the rate cache out of ~/.budget, the
+// only location older versions used, to the default XDG directories unless
+// the data directory is already in use. A data directory chosen with
+// --data-dir, BUDGET_HOME or data_dir may be shared, so private budgets are
+// never moved there; the notice it returns then says so. Call it after
+// Configure, once the log is set up: otherwise it only logs, and files it
+// can't move stay where they are.
+func MigrateLegacyHome() (notice string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	p := CurrentPaths()
+	legacyHome := filepath.Join(home, ".budget")
+	legacyFiles := filepath.Join(legacyHome, "files")
+
+	if _, err := os.Stat(legacyFiles); err != nil || sameDir(legacyFiles, p.DataDir) {
+		return ""
+	}
+	if defaults, err := xdgPaths(); err != nil || !sameDir(p.DataDir, defaults.DataDir) {
+		notice = fmt.Sprintf("Budgets in %s were not moved to %s. Move them yourself if they belong there.", legacyFiles, p.DataDir)
+		log.Print(notice)
+		return notice
+	}
+	if entries, err := os.ReadDir(p.DataDir); err == nil && len(entries) > 0 {
+		return ""
+	}
+
+	if err := moveDir(legacyFiles, p.DataDir); err != nil {
+		log.Printf("moved budgets from %s to %s, except: %v", legacyFiles, p.DataDir, err)
+		return ""
+	}
+	log.Printf("moved budgets from %s to %s", legacyFiles, p.DataDir)
+
+	legacyCache := filepath.Join(legacyHome, "exchange_cache.json")
+	if _, err := os.Stat(legacyCache); err == nil && !sameDir(legacyHome, p.CacheDir) {
+		if err := moveFile(legacyCache, filepath.Join(p.CacheDir, "exchange_cache.json")); err != nil {
+			log.Printf("failed to move the exchange rate cache: %v", err)
+		}
+	}
+
+	// Leave ~/.budget behind only if something other than our files is in it
+	if !sameDir(legacyHome, p.CacheDir) && !sameDir(legacyHome, p.ConfigDir) {
+		os.Remove(filepath.Join(legacyHome, "budget.log"))
+		os.Remove(legacyHome)
+	}
+	return ""
+}
+
+func sameDir(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// moveDir moves a directory's contents, subdirectories included, into dst.
+// It carries on past files it can't move and returns their errors together;
+// src is only removed once it is empty.
+func moveDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entries {
+		from, to := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		if entry.IsDir() {
+			err = moveDir(from, to)
+		} else {
+			err = moveFile(from, to)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", from, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return os.Remove(src)
+}
+
+// moveFile renames a file, copying it when source and target are on different devices
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dst, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useLegacyHome points HOME and the XDG directories at a temporary folder
+// with a ~/.budget as older versions left it, and returns that folder
+func useLegacyHome(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("BUDGET_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+
+	legacy := filepath.Join(home, ".budget")
+	for _, name := range []string{"files/home.json", "files/backups/home.json.v1.bak", "exchange_cache.json"} {
+		path := filepath.Join(legacy, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestMigrateLegacyHome(t *testing.T) {
+	home := useLegacyHome(t)
+	legacy := filepath.Join(home, ".budget")
+
+	p, err := Configure("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "files")); err != nil {
+		t.Fatalf("Configure moved the legacy budgets by itself")
+	}
+
+	if notice := MigrateLegacyHome(); notice != "" {
+		t.Errorf("unexpected notice %q", notice)
+	}
+
+	for _, path := range []string{
+		filepath.Join(p.DataDir, "home.json"),
+		filepath.Join(p.DataDir, "backups", "home.json.v1.bak"),
+		filepath.Join(p.CacheDir, "exchange_cache.json"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s not moved: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("~/.budget left behind")
+	}
+}
+
+func TestMigrateLegacyHomeLeavesChosenDataDir(t *testing.T) {
+	home := useLegacyHome(t)
+	legacy := filepath.Join(home, ".budget")
+
+	shared := filepath.Join(home, "team")
+	if _, err := Configure(shared); err != nil {
+		t.Fatal(err)
+	}
+
+	if notice := MigrateLegacyHome(); notice == "" {
+		t.Errorf("no notice that the budgets were left behind")
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "files", "home.json")); err != nil {
+		t.Errorf("legacy budget moved: %v", err)
+	}
+	if entries, _ := os.ReadDir(shared); len(entries) > 0 {
+		t.Errorf("chosen data directory has %d entries, want none", len(entries))
+	}
+
+	// BUDGET_HOME picks the data directory by hand too
+	t.Setenv("BUDGET_HOME", filepath.Join(home, "budget-home"))
+	if _, err := Configure(""); err != nil {
+		t.Fatal(err)
+	}
+	if notice := MigrateLegacyHome(); notice == "" {
+		t.Errorf("BUDGET_HOME: no notice that the budgets were left behind")
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "files", "home.json")); err != nil {
+		t.Errorf("BUDGET_HOME: legacy budget moved: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Where a price came from
+const (
+	PriceSourceManual = "manual"
+	PriceSourceFile   = "file"
+)
+
+// ErrNoPrice is returned by a PriceProvider that has no price for a symbol
+var ErrNoPrice = errors.New("no price")
+
+// Price is the value of one unit of a symbol
+type Price struct {
+	Value Money `json:"value"`
+	// Empty means the currency of the wallet holding the symbol
+	Currency string    `json:"currency,omitempty"`
+	At       time.Time `json:"at"`
+	Source   string    `json:"source"`
+}
+
+// PriceProvider looks up the latest price of a symbol such as a ticker
+type PriceProvider interface {
+	Price(symbol string) (Price, error)
+}
+
+// normalizeSymbol makes "aapl " and "AAPL" the same symbol
+func normalizeSymbol(symbol string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(symbol))
+	if normalized == "" || strings.ContainsAny(normalized, " \t,") {
+		return "", fmt.Errorf("invalid symbol '%s'", symbol)
+	}
+	return normalized, nil
+}
+
+// ManualPrices returns the prices entered into a budget with SetPrice
+func ManualPrices(data *BudgetFile) PriceProvider {
+	return manualPrices{data}
+}
+
+type manualPrices struct {
+	data *BudgetFile
+}
+
+func (p manualPrices) Price(symbol string) (Price, error) {
+	price, ok := p.data.Prices[symbol]
+	if !ok {
+		return Price{}, fmt.Errorf("%w entered for %s", ErrNoPrice, symbol)
+	}
+	return price, nil
+}
+
+// PriceFile reads prices from a local file, either CSV with the columns
+// symbol, price and optionally currency and date:
+//
+//	AAPL,190.50,USD,2026-10-15
+//
+// or JSON mapping symbols to prices:
+//
+//	{"AAPL": 190.50, "VWCE": {"price": "112.30", "currency": "EUR"}}
+//
+// Prices without a date are as old as the file. The same file prices crypto,
+// commodities and custom units, see unitQuote.
+type PriceFile struct {
+	Path string
+}
+
+// DefaultPriceFile returns the price file set in config.json, or prices.csv
+// or prices.json in the config directory
+func DefaultPriceFile() PriceFile {
+	if config.PriceFile != "" {
+		return PriceFile{Path: expandHome(config.PriceFile)}
+	}
+
+	configDir := CurrentPaths().ConfigDir
+	path := filepath.Join(configDir, "prices.csv")
+	if jsonPath := filepath.Join(configDir, "prices.json"); !fileExists(path) && fileExists(jsonPath) {
+		path = jsonPath
+	}
+	return PriceFile{Path: path}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (f PriceFile) Price(symbol string) (Price, error) {
+	prices, err := f.load()
+	if err != nil {
+		return Price{}, err
+	}
+
+	price, ok := prices[symbol]
+	if !ok {
+		return Price{}, fmt.Errorf("%w for %s in %s", ErrNoPrice, symbol, f.Path)
+	}
+	return price, nil
+}
+
+// load reads the whole file; price files are small and may change while the app runs
+func (f PriceFile) load() (map[string]Price, error) {
+	file, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %v", err)
+	}
+
+	var prices map[string]Price
+	if strings.EqualFold(filepath.Ext(f.Path), ".json") {
+		prices, err = parseJSONPrices(file, info.ModTime())
+	} else {
+		prices, err = parseCSVPrices(file, info.ModTime())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", f.Path, err)
+	}
+	return prices, nil
+}
+
+func parseCSVPrices(r io.Reader, modTime time.Time) (map[string]Price, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]Price)
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected symbol,price[,currency][,date]", i+1)
+		}
+		// Allow a header row
+		if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "symbol") {
+			continue
+		}
+
+		var currency, date string
+		if len(record) > 2 {
+			currency = record[2]
+		}
+		if len(record) > 3 {
+			date = record[3]
+		}
+		symbol, price, err := newFilePrice(record[0], record[1], currency, date, modTime)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		prices[symbol] = price
+	}
+	return prices, nil
+}
+
+func parseJSONPrices(r io.Reader, modTime time.Time) (map[string]Price, error) {
+	var entries map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]Price)
+	for symbol, raw := range entries {
+		var entry struct {
+			Price    json.Number `json:"price"`
+			Currency string      `json:"currency"`
+			Date     string      `json:"date"`
+		}
+		if err := json.Unmarshal(raw, &entry.Price); err != nil {
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil, fmt.Errorf("%s: expected a price or {\"price\", \"currency\", \"date\"}", symbol)
+			}
+		}
+
+		symbol, price, err := newFilePrice(symbol, entry.Price.String(), entry.Currency, entry.Date, modTime)
+		if err != nil {
+			return nil, err
+		}
+		prices[symbol] = price
+	}
+	return prices, nil
+}
+
+func newFilePrice(symbol, value, currency, date string, modTime time.Time) (string, Price, error) {
+	symbol, err := normalizeSymbol(symbol)
+	if err != nil {
+		return "", Price{}, err
+	}
+
+	price := Price{At: modTime, Source: PriceSourceFile}
+	price.Value, err = parseDecimal(value)
+	if err != nil {
+		return "", Price{}, fmt.Errorf("%s: %v", symbol, err)
+	}
+	if price.Value.Sign() < 0 {
+		return "", Price{}, fmt.Errorf("%s: price can't be negative", symbol)
+	}
+	if currency = strings.TrimSpace(currency); currency != "" {
+		unit, err := LookupUnit(currency)
+		if err != nil {
+			return "", Price{}, fmt.Errorf("%s: %v", symbol, err)
+		}
+		price.Currency = unit.Code
+	}
+	if date = strings.TrimSpace(date); date != "" {
+		if price.At, err = parseDate(date); err != nil {
+			return "", Price{}, fmt.Errorf("%s: %v", symbol, err)
+		}
+	}
+
+	return symbol, price, nil
+}
+
+// PriceChain asks every provider and uses the most recent price, so a manual
+// price gives way once the price file is updated
+type PriceChain []PriceProvider
+
+func (c PriceChain) Price(symbol string) (Price, error) {
+	var best Price
+	found := false
+	var lastErr error
+	for _, provider := range c {
+		price, err := provider.Price(symbol)
+		if err != nil {
+			if !errors.Is(err, ErrNoPrice) {
+				lastErr = err
+			}
+			continue
+		}
+		if !found || price.At.After(best.At) {
+			best, found = price, true
+		}
+	}
+
+	if !found {
+		if lastErr != nil {
+			return Price{}, lastErr
+		}
+		return Price{}, fmt.Errorf("%w for %s", ErrNoPrice, symbol)
+	}
+	return best, nil
+}
+
+// DefaultPrices prices holdings from the budget's manual prices and the price file
+func DefaultPrices(data *BudgetFile) PriceProvider {
+	return PriceChain{ManualPrices(data), DefaultPriceFile()}
+}
+
+// SetPrice records a manual price for a symbol and revalues every holding
+// of it. An empty currency means each wallet's own currency.
+func SetPrice(s Store, data *BudgetFile, symbol string, value Money, currency string, prices PriceProvider) error {
+	symbol, err := normalizeSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("price can't be negative")
+	}
+	if currency != "" {
+		unit, err := LookupUnit(currency)
+		if err != nil {
+			return fmt.Errorf("invalid currency: %v", err)
+		}
+		currency = unit.Code
+	}
+
+	description := fmt.Sprintf("price %s at %s", symbol, value)
+	if currency != "" {
+		description += " " + currency
+	}
+	err = data.journal(description, func() error {
+		if data.Prices == nil {
+			data.Prices = make(map[string]Price)
+		}
+		data.Prices[symbol] = Price{Value: value, Currency: currency, At: time.Now(), Source: PriceSourceManual}
+		_, _, err := revalueHoldings(data, prices)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
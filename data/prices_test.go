@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriceFile(t *testing.T) {
+	useTestHome(t, &stubRates{})
+	modTime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		file      string // written to a file of this name, nothing if empty
+		content   string
+		symbol    string
+		want      string // value and currency, e.g. "190.50 USD"
+		wantDate  string // defaults to the file's modification date
+		wantErr   bool   // the file can't be read at all
+		wantPrice bool   // otherwise ErrNoPrice is expected
+	}{
+		{name: "full line", file: "prices.csv", content: "AAPL,190.50,USD,2026-10-15\n", symbol: "AAPL", want: "190.50 USD", wantDate: "2026-10-15", wantPrice: true},
+		{name: "header and lowercase", file: "prices.csv", content: "symbol,price\nvwce , 112.3\n", symbol: "VWCE", want: "112.3 ", wantPrice: true},
+		{name: "comments", file: "prices.csv", content: "# from the broker\nBTC,65000\n", symbol: "BTC", want: "65000 ", wantPrice: true},
+		{name: "later lines win", file: "prices.csv", content: "AAPL,1\nAAPL,2\n", symbol: "AAPL", want: "2 ", wantPrice: true},
+		{name: "other symbol", file: "prices.csv", content: "AAPL,190.50\n", symbol: "MSFT"},
+		{name: "no file", symbol: "AAPL"},
+		{name: "empty file", file: "prices.csv", symbol: "AAPL"},
+		{name: "missing price", file: "prices.csv", content: "AAPL,190.50\nMSFT\n", symbol: "AAPL", wantErr: true},
+		{name: "empty price", file: "prices.csv", content: "AAPL,\n", symbol: "AAPL", wantErr: true},
+		{name: "not a number", file: "prices.csv", content: "AAPL,19O.50\n", symbol: "AAPL", wantErr: true},
+		{name: "negative", file: "prices.csv", content: "AAPL,-1\n", symbol: "AAPL", wantErr: true},
+		{name: "unknown currency", file: "prices.csv", content: "AAPL,1,USX\n", symbol: "AAPL", wantErr: true},
+		{name: "bad date", file: "prices.csv", content: "AAPL,1,USD,15/10/2026\n", symbol: "AAPL", wantErr: true},
+		{name: "no symbol", file: "prices.csv", content: ",1\n", symbol: "AAPL", wantErr: true},
+		{name: "unbalanced quote", file: "prices.csv", content: "\"AAPL,1\n", symbol: "AAPL", wantErr: true},
+		{name: "json number", file: "prices.json", content: `{"AAPL": 190.5}`, symbol: "AAPL", want: "190.5 ", wantPrice: true},
+		{name: "json object", file: "prices.json", content: `{"vwce": {"price": "112.30", "currency": "eur", "date": "2026-10-14"}}`, symbol: "VWCE", want: "112.30 EUR", wantDate: "2026-10-14", wantPrice: true},
+		{name: "json other symbol", file: "prices.json", content: `{"AAPL": 190.5}`, symbol: "MSFT"},
+		{name: "json without price", file: "prices.json", content: `{"AAPL": {"currency": "USD"}}`, symbol: "AAPL", wantErr: true},
+		{name: "json list", file: "prices.json", content: `{"AAPL": [190.5]}`, symbol: "AAPL", wantErr: true},
+		{name: "json truncated", file: "prices.json", content: `{"AAPL": 190.5`, symbol: "AAPL", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "prices.csv")
+			if tt.file != "" {
+				path = filepath.Join(filepath.Dir(path), tt.file)
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			price, err := PriceFile{Path: path}.Price(tt.symbol)
+			switch {
+			case tt.wantErr:
+				if err == nil || errors.Is(err, ErrNoPrice) {
+					t.Fatalf("Price = %v, want a parse error", err)
+				}
+				return
+			case !tt.wantPrice:
+				if !errors.Is(err, ErrNoPrice) {
+					t.Fatalf("Price = %v, want ErrNoPrice", err)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if got := price.Value.String() + " " + price.Currency; got != tt.want {
+				t.Errorf("price = %q, want %q", got, tt.want)
+			}
+			wantDate := modTime.Format(dateLayout)
+			if tt.wantDate != "" {
+				wantDate = tt.wantDate
+			}
+			if got := price.At.Format(dateLayout); got != wantDate || price.Source != PriceSourceFile {
+				t.Errorf("price from %s on %s, want %s on %s", price.Source, got, PriceSourceFile, wantDate)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// The rate history keeps the rates of past days. They don't change once
+// published, so unlike the cache the history never expires and only grows
+// with the days that were asked for. Past snapshots are valued from it and
+// providers may stop serving old days, so it lives with the budgets rather
+// than in the cache, in a folder of its own to keep it out of the budget list.
+func rateHistoryPath() string {
+	return filepath.Join(CurrentPaths().DataDir, "rates", "rate_history.json")
+}
+
+// loadRateHistory reads the rate history, first moving it out of the cache
+// directory where earlier versions kept it
+func loadRateHistory() (*ExchangeRateCache, error) {
+	path := rateHistoryPath()
+	legacy := filepath.Join(CurrentPaths().CacheDir, "rate_history.json")
+	if !fileExists(path) && fileExists(legacy) {
+		if err := moveFile(legacy, path); err != nil {
+			log.Printf("failed to move the rate history to %s: %v", path, err)
+			return loadCache(legacy)
+		}
+	}
+	return loadCache(path)
+}
+
+// isPastDay reports whether day is set and before today
+func isPastDay(day time.Time) bool {
+	if day.IsZero() {
+		return false
+	}
+	return day.Local().Format(dateLayout) < time.Now().Format(dateLayout)
+}
+
+// ratesOn returns rates against base from a table of the given day that quotes it
+func (c *ExchangeRateCache) ratesOn(base, date string) (map[string]float64, bool) {
+	if table, ok := c.Tables[rateKey(base, date)]; ok {
+		return table.Rates, true
+	}
+	for _, table := range c.Tables {
+		if table.Date != date {
+			continue
+		}
+		if rates, ok := rebaseRates(table.Rates, table.Base, base); ok {
+			return rates, true
+		}
+	}
+	return nil, false
+}
+
+// historicalRates returns rates against base as of a past day, from the rate
+// history or else, with fetch, from a provider with historical rates, storing
+// them for next time
+func historicalRates(base string, day time.Time, fetch bool) (map[string]float64, error) {
+	date := day.Local().Format(dateLayout)
+
+	history, err := loadRateHistory()
+	if err != nil {
+		log.Printf("ignoring the rate history: %v", err)
+	}
+	if history == nil {
+		history = &ExchangeRateCache{}
+	}
+	if rates, ok := history.ratesOn(base, date); ok {
+		return rates, nil
+	}
+
+	if !fetch {
+		return nil, fmt.Errorf("no %s rates stored for %s", base, date)
+	}
+	if IsOffline() {
+		return nil, fmt.Errorf("offline, and no %s rates stored for %s", base, date)
+	}
+	provider, ok := currentRateProvider().(HistoricalRateProvider)
+	if !ok {
+		return nil, fmt.Errorf("the %s rate provider has no historical rates", currentRateProvider().Name())
+	}
+
+	rates, err := fetchRates(rateKey(base, date), func() (map[string]float64, error) {
+		return provider.RatesOn(base, day)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no %s rates for %s: %v", base, date, err)
+	}
+
+	if history.Tables == nil {
+		history.Tables = make(map[string]RateTable)
+	}
+	history.Tables[rateKey(base, date)] = RateTable{
+		Base:      base,
+		Date:      date,
+		Rates:     rates,
+		Timestamp: time.Now().Unix(),
+	}
+	if err := saveCache(rateHistoryPath(), history); err != nil {
+		log.Printf("failed to save the rate history: %v", err)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateProvider fetches the latest exchange rates, as units of each currency
+// per one unit of base
+type RateProvider interface {
+	Name() string
+	Rates(base string) (map[string]float64, error)
+}
+
+// HistoricalRateProvider is a RateProvider that also serves the rates of a
+// past day
+type HistoricalRateProvider interface {
+	RateProvider
+	RatesOn(base string, day time.Time) (map[string]float64, error)
+}
+
+// Rate provider names used in config.json
+const (
+	ProviderFrankfurter = "frankfurter"
+	ProviderOpenER      = "open-er"
+	ProviderFile        = "file"
+)
+
+const (
+	defaultFrankfurterURL = "https://api.frankfurter.dev/v1"
+	defaultOpenERURL      = "https://open.er-api.com/v6"
+	defaultRateTimeout    = 10 * time.Second
+)
+
+type FrankfurterResponse struct {
+	Amount float64            `json:"amount"`
+	Base   string             `json:"base"`
+	Date   string             `json:"date"`
+	Rates  map[string]float64 `json:"rates"`
+}
+
+type OpenERResponse struct {
+	Disclaimer string             `json:"disclaimer"`
+	License    string             `json:"license"`
+	Timestamp  int64              `json:"timestamp"`
+	Base       string             `json:"base"`
+	Rates      map[string]float64 `json:"rates"`
+}
+
+// getJSON fetches url and decodes the JSON response into v
+func getJSON(client *http.Client, url, api string, v any) error {
+	if client == nil {
+		client = &http.Client{Timeout: defaultRateTimeout}
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch from %s: %v", api, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s API returned status %d", api, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", api, err)
+	}
+	return nil
+}
+
+// FrankfurterProvider serves the European Central Bank's reference rates
+type FrankfurterProvider struct {
+	BaseURL string // defaults to the public API
+	Client  *http.Client
+}
+
+func (p FrankfurterProvider) Name() string {
+	return "Frankfurter"
+}
+
+func (p FrankfurterProvider) Rates(base string) (map[string]float64, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultFrankfurterURL
+	}
+
+	var frankResp FrankfurterResponse
+	url := fmt.Sprintf("%s/latest?base=%s", strings.TrimRight(baseURL, "/"), base)
+	if err := getJSON(p.Client, url, p.Name(), &frankResp); err != nil {
+		return nil, err
+	}
+	return frankResp.Rates, nil
+}
+
+// RatesOn returns the reference rates of a past day. For weekends and holidays
+// the API answers with the last working day before.
+func (p FrankfurterProvider) RatesOn(base string, day time.Time) (map[string]float64, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultFrankfurterURL
+	}
+
+	var frankResp FrankfurterResponse
+	url := fmt.Sprintf("%s/%s?base=%s", strings.TrimRight(baseURL, "/"), day.Format(dateLayout), base)
+	if err := getJSON(p.Client, url, p.Name(), &frankResp); err != nil {
+		return nil, err
+	}
+	return frankResp.Rates, nil
+}
+
+// OpenERProvider serves rates from open.er-api.com, which covers more currencies
+type OpenERProvider struct {
+	BaseURL string // defaults to the public API
+	Client  *http.Client
+}
+
+func (p OpenERProvider) Name() string {
+	return "Open ER"
+}
+
+func (p OpenERProvider) Rates(base string) (map[string]float64, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenERURL
+	}
+
+	var openResp OpenERResponse
+	url := fmt.Sprintf("%s/latest/%s", strings.TrimRight(baseURL, "/"), base)
+	if err := getJSON(p.Client, url, p.Name(), &openResp); err != nil {
+		return nil, err
+	}
+	return openResp.Rates, nil
+}
+
+// FileRateProvider reads rates from a local JSON file in the shape the
+// Frankfurter API returns, {"base": "EUR", "rates": {"USD": 1.08, ...}}.
+// Rates for any other base are derived from it.
+type FileRateProvider struct {
+	Path string
+}
+
+func (p FileRateProvider) Name() string {
+	return "rates file"
+}
+
+func (p FileRateProvider) Rates(base string) (map[string]float64, error) {
+	content, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %v", err)
+	}
+
+	var file FrankfurterResponse
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", p.Path, err)
+	}
+	fileBase, err := normalizeCurrency(file.Base)
+	if err != nil {
+		return nil, fmt.Errorf("rates file %s: %v", p.Path, err)
+	}
+	rates, ok := rebaseRates(file.Rates, fileBase, base)
+	if !ok {
+		return nil, fmt.Errorf("rates file %s has no rate for %s", p.Path, base)
+	}
+	return rates, nil
+}
+
+// RateChain asks each provider in turn and returns the first rates it gets
+type RateChain []RateProvider
+
+func (c RateChain) Name() string {
+	names := make([]string, len(c))
+	for i, provider := range c {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (c RateChain) Rates(base string) (map[string]float64, error) {
+	base, err := normalizeCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) == 0 {
+		return nil, fmt.Errorf("no exchange rate providers configured")
+	}
+
+	var errs []error
+	for _, provider := range c {
+		rates, err := provider.Rates(base)
+		if err == nil {
+			return rates, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all rate providers failed: %w", errors.Join(errs...))
+}
+
+// RatesOn asks each provider that has historical rates in turn
+func (c RateChain) RatesOn(base string, day time.Time) (map[string]float64, error) {
+	base, err := normalizeCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, provider := range c {
+		historical, ok := provider.(HistoricalRateProvider)
+		if !ok {
+			continue
+		}
+		rates, err := historical.RatesOn(base, day)
+		if err == nil {
+			return rates, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("none of the rate providers (%s) has historical rates", c.Name())
+	}
+	return nil, fmt.Errorf("all rate providers failed: %w", errors.Join(errs...))
+}
+
+// NewRateProvider builds the provider chain described by the currency config
+func NewRateProvider(cfg CurrencyConfig) (RateProvider, error) {
+	timeout := defaultRateTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	names := cfg.Providers
+	if len(names) == 0 {
+		names = []string{ProviderFrankfurter, ProviderOpenER}
+		if cfg.RatesFile != "" {
+			names = append(names, ProviderFile)
+		}
+	}
+
+	var chain RateChain
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case ProviderFrankfurter:
+			chain = append(chain, FrankfurterProvider{BaseURL: cfg.PrimaryAPI, Client: client})
+		case ProviderOpenER:
+			chain = append(chain, OpenERProvider{BaseURL: cfg.BackupAPI, Client: client})
+		case ProviderFile:
+			if cfg.RatesFile == "" {
+				return nil, fmt.Errorf("the %q rate provider needs rates_file to be set", ProviderFile)
+			}
+			chain = append(chain, FileRateProvider{Path: expandHome(cfg.RatesFile)})
+		default:
+			return nil, fmt.Errorf("unknown rate provider %q", name)
+		}
+	}
+	return chain, nil
+}
+
+var rateProvider struct {
+	mu       sync.Mutex
+	provider RateProvider
+}
+
+// SetRateProvider replaces where exchange rates come from, for example with
+// a stand-in server or a file. nil goes back to the configured providers.
+func SetRateProvider(provider RateProvider) {
+	rateProvider.mu.Lock()
+	defer rateProvider.mu.Unlock()
+	rateProvider.provider = provider
+}
+
+// currentRateProvider returns the provider set with SetRateProvider, or
+// builds the configured chain on first use
+func currentRateProvider() RateProvider {
+	rateProvider.mu.Lock()
+	defer rateProvider.mu.Unlock()
+
+	if rateProvider.provider == nil {
+		provider, err := NewRateProvider(config.Currency)
+		if err != nil {
+			log.Printf("exchange rates: %v; using the default providers", err)
+			provider, _ = NewRateProvider(CurrencyConfig{})
+		}
+		rateProvider.provider = provider
+	}
+	return rateProvider.provider
+}
@@ -0,0 +1,319 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rateServer answers like the Frankfurter or Open ER API, recording the paths
+// it was asked for. status other than 200 makes every request fail.
+func rateServer(t *testing.T, status int, body any) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestFrankfurterProvider(t *testing.T) {
+	server, requests := rateServer(t, http.StatusOK, FrankfurterResponse{Base: "EUR", Rates: map[string]float64{"USD": 1.08}})
+	provider := FrankfurterProvider{BaseURL: server.URL + "/"}
+
+	rates, err := provider.Rates("EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["USD"] != 1.08 {
+		t.Errorf("USD = %v, want 1.08", rates["USD"])
+	}
+
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local)
+	if _, err := provider.RatesOn("EUR", day); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/latest?base=EUR", "/2024-03-15?base=EUR"}
+	if strings.Join(*requests, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %v, want %v", *requests, want)
+	}
+}
+
+func TestOpenERProvider(t *testing.T) {
+	server, requests := rateServer(t, http.StatusOK, OpenERResponse{Base: "USD", Rates: map[string]float64{"ARS": 1050}})
+
+	rates, err := OpenERProvider{BaseURL: server.URL}.Rates("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["ARS"] != 1050 {
+		t.Errorf("ARS = %v, want 1050", rates["ARS"])
+	}
+	if len(*requests) != 1 || (*requests)[0] != "/latest/USD" {
+		t.Errorf("requests = %v, want /latest/USD", *requests)
+	}
+}
+
+func TestProviderReportsHTTPErrors(t *testing.T) {
+	server, _ := rateServer(t, http.StatusTooManyRequests, nil)
+
+	_, err := FrankfurterProvider{BaseURL: server.URL}.Rates("EUR")
+	if err == nil || !strings.Contains(err.Error(), "status 429") {
+		t.Errorf("err = %v, want the status", err)
+	}
+}
+
+func TestFileRateProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base": "eur", "rates": {"USD": 1.25, "GBP": 0.8}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := FileRateProvider{Path: path}
+
+	rates, err := provider.Rates("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["EUR"] != 0.8 || rates["GBP"] != 0.64 {
+		t.Errorf("rebased rates = %v, want EUR 0.8 and GBP 0.64", rates)
+	}
+	if _, err := provider.Rates("JPY"); err == nil {
+		t.Errorf("rates for a base missing from the file should fail")
+	}
+}
+
+// failingProvider always fails, and has no historical rates
+type failingProvider struct{ name string }
+
+func (p failingProvider) Name() string { return p.name }
+
+func (p failingProvider) Rates(base string) (map[string]float64, error) {
+	return nil, errors.New(p.name + " is down")
+}
+
+func TestRateChainFallsBackInOrder(t *testing.T) {
+	first, firstRequests := rateServer(t, http.StatusInternalServerError, nil)
+	second, secondRequests := rateServer(t, http.StatusOK, OpenERResponse{Rates: map[string]float64{"EUR": 0.9}})
+	third, thirdRequests := rateServer(t, http.StatusOK, FrankfurterResponse{Rates: map[string]float64{"EUR": 0.5}})
+	chain := RateChain{
+		FrankfurterProvider{BaseURL: first.URL},
+		OpenERProvider{BaseURL: second.URL},
+		FrankfurterProvider{BaseURL: third.URL},
+	}
+
+	rates, err := chain.Rates("usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["EUR"] != 0.9 {
+		t.Errorf("EUR = %v, want the second provider's 0.9", rates["EUR"])
+	}
+	if len(*firstRequests) != 1 || len(*secondRequests) != 1 || len(*thirdRequests) != 0 {
+		t.Errorf("requests per provider = %d, %d, %d; want 1, 1, 0", len(*firstRequests), len(*secondRequests), len(*thirdRequests))
+	}
+}
+
+func TestRateChainJoinsErrors(t *testing.T) {
+	chain := RateChain{failingProvider{"alpha"}, failingProvider{"beta"}}
+
+	_, err := chain.Rates("EUR")
+	if err == nil || !strings.Contains(err.Error(), "alpha is down") || !strings.Contains(err.Error(), "beta is down") {
+		t.Errorf("err = %v, want both failures", err)
+	}
+	if _, err := (RateChain{}).Rates("EUR"); err == nil {
+		t.Errorf("an empty chain should fail")
+	}
+	if _, err := chain.Rates("EURO"); err == nil {
+		t.Errorf("an invalid base should fail")
+	}
+}
+
+func TestRateChainRatesOnSkipsProvidersWithoutHistory(t *testing.T) {
+	server, requests := rateServer(t, http.StatusOK, FrankfurterResponse{Rates: map[string]float64{"USD": 1.1}})
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local)
+
+	chain := RateChain{failingProvider{"alpha"}, FrankfurterProvider{BaseURL: server.URL}}
+	rates, err := chain.RatesOn("EUR", day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["USD"] != 1.1 || len(*requests) != 1 || (*requests)[0] != "/2024-03-15?base=EUR" {
+		t.Errorf("rates = %v after %v", rates, *requests)
+	}
+
+	if _, err := (RateChain{failingProvider{"alpha"}}).RatesOn("EUR", day); err == nil || !strings.Contains(err.Error(), "historical") {
+		t.Errorf("err = %v, want no historical rates", err)
+	}
+}
+
+func TestNewRateProvider(t *testing.T) {
+	tests := []struct {
+		cfg     CurrencyConfig
+		want    string
+		wantErr bool
+	}{
+		{CurrencyConfig{}, "Frankfurter, Open ER", false},
+		{CurrencyConfig{RatesFile: "rates.json"}, "Frankfurter, Open ER, rates file", false},
+		{CurrencyConfig{Providers: []string{"open-er"}}, "Open ER", false},
+		{CurrencyConfig{Providers: []string{"file"}}, "", true},
+		{CurrencyConfig{Providers: []string{"nope"}}, "", true},
+	}
+	for _, tt := range tests {
+		provider, err := NewRateProvider(tt.cfg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewRateProvider(%+v) should fail", tt.cfg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewRateProvider(%+v): %v", tt.cfg, err)
+			continue
+		}
+		if provider.Name() != tt.want {
+			t.Errorf("NewRateProvider(%+v) = %s, want %s", tt.cfg, provider.Name(), tt.want)
+		}
+	}
+}
+
+func TestExchangeRatesFetchedOnceAndCached(t *testing.T) {
+	provider := &stubRates{rates: map[string]float64{"USD": 1.25, "GBP": 0.8}}
+	useTestHome(t, provider)
+
+	for _, pair := range [][2]string{{"EUR", "USD"}, {"USD", "EUR"}, {"GBP", "USD"}} {
+		if _, err := ExchangeRate(pair[0], pair[1], "EUR", nil); err != nil {
+			t.Fatalf("%s to %s: %v", pair[0], pair[1], err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("rates fetched %d times, want once", provider.calls)
+	}
+
+	SetOffline(true)
+	if _, err := ExchangeRate("USD", "GBP", "USD", nil); err != nil {
+		t.Errorf("offline conversion from cached rates: %v", err)
+	}
+}
+
+func TestRateHistoryKeptWithBudgets(t *testing.T) {
+	provider := &stubRates{rates: map[string]float64{"USD": 1.25}}
+	p := useTestHome(t, provider)
+	day := time.Now().AddDate(0, 0, -30)
+
+	// An older version left a history for another day in the cache
+	legacy := &ExchangeRateCache{Tables: map[string]RateTable{
+		rateKey("EUR", "2024-03-15"): {Base: "EUR", Date: "2024-03-15", Rates: map[string]float64{"USD": 1.1}},
+	}}
+	if err := saveCache(filepath.Join(p.CacheDir, "rate_history.json"), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := historicalRates("EUR", day, true); err != nil {
+		t.Fatal(err)
+	}
+	history, err := loadCache(filepath.Join(p.DataDir, "rates", "rate_history.json"))
+	if err != nil || history == nil || len(history.Tables) != 2 {
+		t.Fatalf("rate history in the data directory = %+v, %v; want both days", history, err)
+	}
+	if _, err := os.Stat(filepath.Join(p.CacheDir, "rate_history.json")); !os.IsNotExist(err) {
+		t.Errorf("the history was left in the cache directory")
+	}
+
+	// The moved history still serves its day, and is no budget
+	if rates, err := historicalRates("EUR", time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local), false); err != nil || rates["USD"] != 1.1 {
+		t.Errorf("rates from the moved history = %v, %v", rates, err)
+	}
+	if budgets, err := DefaultStore().List(); err != nil || len(budgets) != 0 {
+		t.Errorf("budget list = %d budgets, %v; want none", len(budgets), err)
+	}
+}
+
+// seedRateCache stores one EUR table fetched age ago, as if from an earlier run
+func seedRateCache(t *testing.T, age time.Duration) {
+	t.Helper()
+	fetched := time.Now().Add(-age)
+	cache := &ExchangeRateCache{}
+	cache.store(RateTable{
+		Base:      "EUR",
+		Date:      fetched.Format(dateLayout),
+		Rates:     map[string]float64{"USD": 1.25, "GBP": 0.8, "JPY": 160},
+		Timestamp: fetched.Unix(),
+		TTL:       defaultCacheTTL,
+	})
+	if err := saveCache(getCachePath(), cache); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOneCachedBaseServesEveryPair(t *testing.T) {
+	provider := &stubRates{rates: map[string]float64{"USD": 2, "GBP": 2, "JPY": 2}}
+	useTestHome(t, provider)
+	seedRateCache(t, time.Minute)
+
+	tests := []struct {
+		from, to, base string
+		want           float64
+	}{
+		{"USD", "GBP", "USD", 0.64},
+		{"USD", "GBP", "GBP", 0.64},
+		{"GBP", "USD", "JPY", 1.5625},
+		{"EUR", "JPY", "USD", 160},
+		{"JPY", "EUR", "GBP", 1.0 / 160},
+	}
+	for _, tt := range tests {
+		rate, err := ExchangeRate(tt.from, tt.to, tt.base, nil)
+		if err != nil {
+			t.Errorf("%s to %s against %s: %v", tt.from, tt.to, tt.base, err)
+			continue
+		}
+		if diff := rate - tt.want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("%s to %s against %s = %v, want %v", tt.from, tt.to, tt.base, rate, tt.want)
+		}
+	}
+	if provider.calls != 0 {
+		t.Errorf("rates fetched %d times, want none while the EUR table is fresh", provider.calls)
+	}
+	if table, ok := RatesAsOf("USD"); !ok || table.Base != "EUR" || !table.Fresh() {
+		t.Errorf("RatesAsOf(USD) = %+v, %v; want the fresh EUR table", table, ok)
+	}
+}
+
+func TestExpiredRatesUsedWhenProvidersFail(t *testing.T) {
+	useTestHome(t, RateChain{failingProvider{"alpha"}, failingProvider{"beta"}})
+	seedRateCache(t, 72*time.Hour)
+
+	rate, err := ExchangeRate("USD", "GBP", "EUR", nil)
+	if err != nil {
+		t.Fatalf("conversion with every provider down: %v", err)
+	}
+	if rate != 0.64 {
+		t.Errorf("USD to GBP = %v, want 0.64 from the expired table", rate)
+	}
+
+	table, ok := RatesAsOf("EUR")
+	if !ok || table.Fresh() {
+		t.Fatalf("RatesAsOf(EUR) = %+v, %v; want the expired table", table, ok)
+	}
+	if age := time.Since(table.AsOf()); age < 71*time.Hour || age > 73*time.Hour {
+		t.Errorf("rates are %v old, want 72h", age)
+	}
+
+	// A currency the cache never quoted still fails, naming the providers
+	if _, err := ExchangeRate("USD", "CHF", "CHF", nil); err == nil || !strings.Contains(err.Error(), "alpha is down") {
+		t.Errorf("CHF with no cached rates = %v, want the provider errors", err)
+	}
+}
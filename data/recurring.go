@@ -0,0 +1,432 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type Cadence string
+
+const (
+	CadenceDaily      Cadence = "daily"
+	CadenceWeekly     Cadence = "weekly"      // on the start date's weekday
+	CadenceMonthly    Cadence = "monthly"     // on the start date's day, or the month's last day if shorter
+	CadenceYearly     Cadence = "yearly"      // on the start date's day and month, Feb 28 for Feb 29 in other years
+	CadenceNthWeekday Cadence = "nth_weekday" // e.g. the 2nd Friday of every month
+)
+
+const dateLayout = "2006-01-02"
+
+// RecurringRule posts the same amount to a wallet on a schedule, or just
+// declares it for forecasting. Dates are YYYY-MM-DD in local time.
+type RecurringRule struct {
+	ID       string  `json:"id"`
+	WalletID string  `json:"wallet_id"`
+	Amount   Money   `json:"amount"`
+	Memo     string  `json:"memo,omitempty"`
+	Cadence  Cadence `json:"cadence"`
+	// For CadenceNthWeekday: 1 to 4 for the first to fourth, -1 for the last
+	Nth     int          `json:"nth,omitempty"`
+	Weekday time.Weekday `json:"weekday,omitempty"`
+	Start   string       `json:"start"`
+	End     string       `json:"end,omitempty"`
+	Paused  bool         `json:"paused,omitempty"`
+	// Currency of Amount when it differs from the wallet's; converted when posted
+	Currency string `json:"currency,omitempty"`
+	// Expected items are only projected by ForecastBalances, never posted
+	Expected bool `json:"expected,omitempty"`
+	// Occurrences up to and including this date have been posted or skipped
+	PostedThrough string `json:"posted_through,omitempty"`
+}
+
+// PostedOccurrence is one transaction posted by ApplyDueRecurring
+type PostedOccurrence struct {
+	Rule     RecurringRule
+	Wallet   string // wallet name
+	Amount   Money  // in the wallet's currency
+	Currency string // the wallet's currency
+	Date     time.Time
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var nthNames = map[string]int{"1st": 1, "2nd": 2, "3rd": 3, "4th": 4, "last": -1}
+
+// ParseCadence reads "daily", "weekly", "monthly", "yearly" or an nth weekday
+// such as "2nd-fri" or "last-monday" into the cadence fields of rule
+func ParseCadence(s string, rule *RecurringRule) error {
+	s = strings.ToLower(s)
+	switch Cadence(s) {
+	case CadenceDaily, CadenceWeekly, CadenceMonthly, CadenceYearly:
+		rule.Cadence = Cadence(s)
+		return nil
+	}
+
+	nthStr, weekdayStr, found := strings.Cut(s, "-")
+	nth, nthOK := nthNames[nthStr]
+	weekday, weekdayOK := weekdayNames[weekdayStr]
+	if !found || !nthOK || !weekdayOK {
+		return fmt.Errorf("unknown cadence '%s', use daily, weekly, monthly, yearly or e.g. 2nd-fri, last-mon", s)
+	}
+
+	rule.Cadence = CadenceNthWeekday
+	rule.Nth = nth
+	rule.Weekday = weekday
+	return nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.ParseInLocation(dateLayout, s, time.Local)
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// Describe returns the schedule in words, e.g. "monthly on day 25"
+func (r RecurringRule) Describe() string {
+	start, _ := parseDate(r.Start)
+	switch r.Cadence {
+	case CadenceDaily:
+		return "daily"
+	case CadenceWeekly:
+		return "weekly on " + start.Weekday().String()
+	case CadenceMonthly:
+		return fmt.Sprintf("monthly on day %d", start.Day())
+	case CadenceYearly:
+		return "yearly on " + start.Format("January 2")
+	case CadenceNthWeekday:
+		nth := "last"
+		for name, n := range nthNames {
+			if n == r.Nth {
+				nth = name
+			}
+		}
+		return fmt.Sprintf("every %s %s", nth, r.Weekday)
+	}
+	return string(r.Cadence)
+}
+
+// activeOn reports whether the rule has an occurrence on date, within its start and end
+func (r RecurringRule) activeOn(date time.Time) bool {
+	start, err := parseDate(r.Start)
+	if err != nil || date.Before(start) {
+		return false
+	}
+	if r.End != "" {
+		end, err := parseDate(r.End)
+		if err != nil || date.After(end) {
+			return false
+		}
+	}
+	return r.fallsOn(date, start)
+}
+
+// fallsOn reports whether the rule has an occurrence on date, ignoring start and end
+func (r RecurringRule) fallsOn(date, start time.Time) bool {
+	switch r.Cadence {
+	case CadenceDaily:
+		return true
+	case CadenceWeekly:
+		return date.Weekday() == start.Weekday()
+	case CadenceMonthly:
+		return date.Day() == min(start.Day(), daysInMonth(date))
+	case CadenceYearly:
+		return date.Month() == start.Month() && date.Day() == min(start.Day(), daysInMonth(date))
+	case CadenceNthWeekday:
+		if date.Weekday() != r.Weekday {
+			return false
+		}
+		if r.Nth < 0 {
+			return date.Day()+7 > daysInMonth(date)
+		}
+		return (date.Day()-1)/7+1 == r.Nth
+	}
+	return false
+}
+
+// dueDates returns the occurrences after PostedThrough up to and including today
+func (r RecurringRule) dueDates(today time.Time) ([]time.Time, error) {
+	start, err := parseDate(r.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date '%s': %v", r.Start, err)
+	}
+
+	from := start
+	if r.PostedThrough != "" {
+		postedThrough, err := parseDate(r.PostedThrough)
+		if err != nil {
+			return nil, fmt.Errorf("invalid posted_through date '%s': %v", r.PostedThrough, err)
+		}
+		from = later(from, postedThrough.AddDate(0, 0, 1))
+	}
+
+	through := startOfDay(today)
+	if r.End != "" {
+		end, err := parseDate(r.End)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end date '%s': %v", r.End, err)
+		}
+		if end.Before(through) {
+			through = end
+		}
+	}
+
+	var dates []time.Time
+	for date := from; !date.After(through); date = date.AddDate(0, 0, 1) {
+		if r.fallsOn(date, start) {
+			dates = append(dates, date)
+		}
+	}
+	return dates, nil
+}
+
+// NextOccurrence returns the first occurrence after today, if the rule has one
+func (r RecurringRule) NextOccurrence(today time.Time) (time.Time, bool) {
+	start, err := parseDate(r.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, hasEnd := time.Time{}, r.End != ""
+	if hasEnd {
+		if end, err = parseDate(r.End); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	// Every cadence repeats within a year
+	date := later(start, startOfDay(today).AddDate(0, 0, 1))
+	for limit := date.AddDate(1, 0, 1); date.Before(limit); date = date.AddDate(0, 0, 1) {
+		if hasEnd && date.After(end) {
+			return time.Time{}, false
+		}
+		if r.fallsOn(date, start) {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// amountIn returns the rule's amount in the wallet's currency and the rate
+// used, which is 0 when no conversion was needed
+func (r RecurringRule) amountIn(wallet Wallet, baseCurrency string, overrides RateOverrides) (Money, float64, error) {
+	if r.Currency == "" || r.Currency == wallet.Currency {
+		return r.Amount, 0, nil
+	}
+
+	rate, err := ExchangeRate(r.Currency, wallet.Currency, baseCurrency, overrides)
+	if err != nil {
+		return Money{}, 0, err
+	}
+	amount, err := r.Amount.MulRate(rate, CurrencyExponent(wallet.Currency))
+	if err != nil {
+		return Money{}, 0, err
+	}
+	return amount, rate, nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// AddRecurringRule validates a rule and adds it to the budget. Start defaults to today.
+func AddRecurringRule(s Store, data *BudgetFile, rule RecurringRule) error {
+	walletIndex, err := FindWallet(data, rule.WalletID)
+	if err != nil {
+		return err
+	}
+	if rule.Amount.IsZero() {
+		return fmt.Errorf("recurring amount can't be zero")
+	}
+	if rule.Currency != "" {
+		unit, err := LookupUnit(rule.Currency)
+		if err != nil {
+			return fmt.Errorf("invalid currency: %v", err)
+		}
+		rule.Currency = unit.Code
+	}
+	if rule.Start == "" {
+		rule.Start = time.Now().Format(dateLayout)
+	}
+	start, err := parseDate(rule.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start date '%s', use YYYY-MM-DD", rule.Start)
+	}
+	if rule.End != "" {
+		end, err := parseDate(rule.End)
+		if err != nil {
+			return fmt.Errorf("invalid end date '%s', use YYYY-MM-DD", rule.End)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("end date %s is before start date %s", rule.End, rule.Start)
+		}
+	}
+
+	rule.ID = newID()
+	description := fmt.Sprintf("add recurring rule for '%s'", data.Wallets[walletIndex].Name)
+	err = data.journal(description, func() error {
+		data.Recurring = append(data.Recurring, rule)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
+
+func findRule(data *BudgetFile, id string) (int, error) {
+	for i, rule := range data.Recurring {
+		if rule.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("recurring rule '%s' not found", id)
+}
+
+// SetRecurringPaused pauses or resumes a rule. Occurrences missed while a
+// rule was paused are skipped, not posted on resume.
+func SetRecurringPaused(s Store, data *BudgetFile, id string, paused bool) error {
+	index, err := findRule(data, id)
+	if err != nil {
+		return err
+	}
+
+	description := "resume recurring rule"
+	if paused {
+		description = "pause recurring rule"
+	}
+	err = data.journal(description, func() error {
+		rule := &data.Recurring[index]
+		if !paused && rule.Paused {
+			yesterday := startOfDay(time.Now()).AddDate(0, 0, -1).Format(dateLayout)
+			if rule.PostedThrough < yesterday {
+				rule.PostedThrough = yesterday
+			}
+		}
+		rule.Paused = paused
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
+
+func DeleteRecurringRule(s Store, data *BudgetFile, id string) error {
+	index, err := findRule(data, id)
+	if err != nil {
+		return err
+	}
+
+	err = data.journal("delete recurring rule", func() error {
+		data.Recurring = append(data.Recurring[:index], data.Recurring[index+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
+
+// ApplyDueRecurring posts every occurrence that came due since the budget was
+// last opened, and saves if anything was posted. Rules whose wallet is gone
+// are left alone, and so are rules in another currency while no rate is
+// available; they're posted once one is.
+func ApplyDueRecurring(s Store, data *BudgetFile, today time.Time) ([]PostedOccurrence, error) {
+	type due struct {
+		rule, wallet int
+		dates        []time.Time
+		amount       Money
+		rate         float64
+		rateSource   string
+	}
+
+	baseCurrency, _ := GetDefaultCurrency(data)
+
+	var pending []due
+	count := 0
+	for i, rule := range data.Recurring {
+		if rule.Paused || rule.Expected {
+			continue
+		}
+		walletIndex, err := FindWallet(data, rule.WalletID)
+		if err != nil {
+			continue
+		}
+		wallet := data.Wallets[walletIndex]
+		dates, err := rule.dueDates(today)
+		if err != nil {
+			return nil, fmt.Errorf("recurring rule for '%s': %v", wallet.Name, err)
+		}
+		if len(dates) == 0 {
+			continue
+		}
+		amount, rate, err := rule.amountIn(wallet, baseCurrency, data.RateOverrides)
+		if err != nil {
+			log.Printf("recurring rule for '%s' not posted yet: %v", wallet.Name, err)
+			continue
+		}
+		rateSource := ""
+		if rate != 0 {
+			rateSource = data.RateOverrides.source(rule.Currency, wallet.Currency, baseCurrency)
+		}
+		pending = append(pending, due{i, walletIndex, dates, amount, rate, rateSource})
+		count += len(dates)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	var posted []PostedOccurrence
+	description := fmt.Sprintf("post %d recurring transaction(s)", count)
+	err := data.journal(description, func() error {
+		for _, d := range pending {
+			rule := &data.Recurring[d.rule]
+			wallet := &data.Wallets[d.wallet]
+			for _, date := range d.dates {
+				tx := Transaction{
+					Timestamp: date,
+					Amount:    d.amount,
+					Memo:      rule.Memo,
+					Kind:      TransactionRecurring,
+				}
+				if d.rate != 0 {
+					tx.Rate = d.rate
+					tx.RateSource = d.rateSource
+				}
+				if _, err := wallet.record(tx); err != nil {
+					return fmt.Errorf("recurring rule for '%s': %w", wallet.Name, err)
+				}
+				posted = append(posted, PostedOccurrence{Rule: *rule, Wallet: wallet.Name, Amount: d.amount, Currency: wallet.Currency, Date: date})
+			}
+			rule.PostedThrough = d.dates[len(d.dates)-1].Format(dateLayout)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Save(data); err != nil {
+		return nil, err
+	}
+	return posted, nil
+}
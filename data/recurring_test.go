@@ -0,0 +1,141 @@
+package data
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	date, err := parseDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return date
+}
+
+func TestRuleFallsOn(t *testing.T) {
+	tests := []struct {
+		cadence string
+		start   string
+		date    string
+		want    bool
+	}{
+		// The 31st clamps to the last day of shorter months
+		{"monthly", "2024-01-31", "2024-02-29", true},
+		{"monthly", "2024-01-31", "2024-02-28", false},
+		{"monthly", "2024-01-31", "2025-02-28", true},
+		{"monthly", "2024-01-31", "2024-04-30", true},
+		{"monthly", "2024-01-31", "2024-03-30", false},
+		{"monthly", "2024-01-31", "2024-03-31", true},
+		{"weekly", "2024-01-03", "2024-01-10", true},
+		{"weekly", "2024-01-03", "2024-01-11", false},
+		{"weekly", "2024-01-03", "2025-01-01", true},
+		{"yearly", "2024-06-15", "2025-06-15", true},
+		{"yearly", "2024-06-15", "2025-07-15", false},
+		// Feb 29 falls back to Feb 28 outside leap years
+		{"yearly", "2024-02-29", "2025-02-28", true},
+		{"yearly", "2024-02-29", "2025-03-01", false},
+		{"yearly", "2024-02-29", "2028-02-28", false},
+		{"yearly", "2024-02-29", "2028-02-29", true},
+		{"2nd-fri", "2024-01-01", "2024-03-08", true},
+		{"2nd-fri", "2024-01-01", "2024-03-15", false},
+		{"last-mon", "2024-01-01", "2024-09-30", true},
+		{"last-mon", "2024-01-01", "2024-09-23", false},
+	}
+	for _, tt := range tests {
+		var rule RecurringRule
+		if err := ParseCadence(tt.cadence, &rule); err != nil {
+			t.Fatal(err)
+		}
+		if got := rule.fallsOn(mustDate(t, tt.date), mustDate(t, tt.start)); got != tt.want {
+			t.Errorf("%s from %s on %s = %v, want %v", tt.cadence, tt.start, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestRuleDueDates(t *testing.T) {
+	tests := []struct {
+		name          string
+		cadence       string
+		start, end    string
+		postedThrough string
+		today         string
+		want          []string
+	}{
+		{
+			name: "month ends", cadence: "monthly", start: "2024-01-31", postedThrough: "2024-01-31", today: "2024-06-15",
+			want: []string{"2024-02-29", "2024-03-31", "2024-04-30", "2024-05-31"},
+		},
+		{
+			name: "leap days", cadence: "yearly", start: "2020-02-29", today: "2024-03-01",
+			want: []string{"2020-02-29", "2021-02-28", "2022-02-28", "2023-02-28", "2024-02-29"},
+		},
+		{
+			name: "until the end date", cadence: "daily", start: "2024-01-01", end: "2024-01-03", today: "2024-02-01",
+			want: []string{"2024-01-01", "2024-01-02", "2024-01-03"},
+		},
+		{
+			name: "including today", cadence: "weekly", start: "2024-01-03", postedThrough: "2024-01-03", today: "2024-01-17",
+			want: []string{"2024-01-10", "2024-01-17"},
+		},
+		{
+			name: "nothing new", cadence: "monthly", start: "2024-01-15", postedThrough: "2024-03-15", today: "2024-04-14",
+		},
+		{
+			name: "not started", cadence: "daily", start: "2024-05-01", today: "2024-04-30",
+		},
+	}
+	for _, tt := range tests {
+		rule := RecurringRule{Start: tt.start, End: tt.end, PostedThrough: tt.postedThrough}
+		if err := ParseCadence(tt.cadence, &rule); err != nil {
+			t.Fatal(err)
+		}
+		dates, err := rule.dueDates(mustDate(t, tt.today))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, date := range dates {
+			got = append(got, date.Format(dateLayout))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: due %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyDueRecurringCatchesUp(t *testing.T) {
+	useTestHome(t, &stubRates{})
+	s, budget, id := newTestBudget(t)
+
+	// A weekly rule last posted a year ago, on a Monday
+	rule := RecurringRule{WalletID: id, Amount: NewMoney(-1000, 2), Cadence: CadenceWeekly, Start: "2024-01-01"}
+	if err := AddRecurringRule(s, budget, rule); err != nil {
+		t.Fatal(err)
+	}
+	today := mustDate(t, "2024-12-31")
+
+	posted, err := ApplyDueRecurring(s, budget, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posted) != 53 {
+		t.Fatalf("posted %d occurrences, want the 53 Mondays of 2024", len(posted))
+	}
+	if first, last := posted[0].Date.Format(dateLayout), posted[52].Date.Format(dateLayout); first != "2024-01-01" || last != "2024-12-30" {
+		t.Errorf("posted %s to %s, want 2024-01-01 to 2024-12-30", first, last)
+	}
+	if budget.Wallets[0].Balance.String() != "-430.00" {
+		t.Errorf("balance = %s, want -430.00", budget.Wallets[0].Balance)
+	}
+	if budget.Recurring[0].PostedThrough != "2024-12-30" {
+		t.Errorf("posted through %s, want 2024-12-30", budget.Recurring[0].PostedThrough)
+	}
+
+	// Opening again the same day posts nothing twice
+	if posted, err := ApplyDueRecurring(s, budget, today); err != nil || len(posted) != 0 {
+		t.Errorf("second run posted %d (%v), want none", len(posted), err)
+	}
+}
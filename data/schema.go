@@ -0,0 +1,185 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CurrentSchemaVersion is the budget file format written by this version of the app.
+// Files without a schema_version field are treated as version 0.
+const CurrentSchemaVersion = 8
+
+// migration upgrades a decoded budget by exactly one schema version
+type migration struct {
+	version     int // version the budget is at once the migration ran
+	description string
+	apply       func(budgetFile *BudgetFile, filename string)
+}
+
+// migrations must stay ordered by version, one entry per version
+var migrations = []migration{
+	{1, "convert legacy wallet list to a named budget file", migrateLegacyBudgetData},
+	{2, "round amounts to their currency", migrateRoundAmounts},
+	{3, "record opening balances in wallet ledgers", migrateOpeningBalances},
+	{4, "assign stable wallet IDs", migrateWalletIDs},
+	{5, "allow encrypted budget files", migrateEncryptionSupport},
+	{6, "record a first net-worth snapshot", migrateFirstSnapshot},
+	{7, "keep only the changes in the undo journal", migrateCompactJournal},
+	{8, "mark currency changes in wallet ledgers", migrateCurrencyChanges},
+}
+
+// decodeBudgetFile parses a budget file of any known schema version and
+// upgrades it to CurrentSchemaVersion. It returns the version it started at.
+func decodeBudgetFile(content []byte, filename string) (*BudgetFile, int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse budget file '%s': %v", filename, err)
+	}
+	if header.SchemaVersion > CurrentSchemaVersion {
+		return nil, 0, fmt.Errorf("budget file '%s' uses schema version %d, but this app only supports up to version %d; please update the app", filename, header.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	// Every earlier format decodes into BudgetFile: BudgetData is a subset of
+	// its fields and Money accepts the plain numbers older files stored.
+	var budgetFile BudgetFile
+	if err := json.Unmarshal(content, &budgetFile); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse budget file '%s': %v", filename, err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= budgetFile.SchemaVersion {
+			continue
+		}
+		m.apply(&budgetFile, filename)
+		budgetFile.SchemaVersion = m.version
+		log.Printf("budget '%s': migrated to schema version %d (%s)", filename, m.version, m.description)
+	}
+
+	return &budgetFile, header.SchemaVersion, nil
+}
+
+// backupBudgetFile keeps a copy of a budget file as it was before a migration
+func backupBudgetFile(filePath string, content []byte, version int) error {
+	backupPath := fmt.Sprintf("%s.v%d.bak", filePath, version)
+	if err := writeFileAtomic(backupPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to back up '%s' before migrating: %v", filepath.Base(filePath), err)
+	}
+	log.Printf("backed up schema version %d of '%s' to %s", version, filepath.Base(filePath), backupPath)
+	return nil
+}
+
+// migrateLegacyBudgetData names files saved in the BudgetData format
+func migrateLegacyBudgetData(budgetFile *BudgetFile, filename string) {
+	if budgetFile.Name != "" {
+		return
+	}
+
+	now := time.Now()
+	budgetFile.Name = filename
+	budgetFile.CreatedAt = now
+	budgetFile.UpdatedAt = now
+
+	// If no default currency, try to infer from first wallet
+	if budgetFile.DefaultCurrency == "" && len(budgetFile.Wallets) > 0 {
+		budgetFile.DefaultCurrency = budgetFile.Wallets[0].Currency
+	}
+}
+
+// migrateRoundAmounts rounds float balances from older files to their
+// currency's precision. Amounts too large for it keep the one they have.
+func migrateRoundAmounts(budgetFile *BudgetFile, filename string) {
+	for i := range budgetFile.Wallets {
+		wallet := &budgetFile.Wallets[i]
+		exp := CurrencyExponent(wallet.Currency)
+		if balance, err := wallet.Balance.Rescale(exp); err == nil {
+			wallet.Balance = balance
+		}
+		for j := range wallet.Transactions {
+			if amount, err := wallet.Transactions[j].Amount.Rescale(exp); err == nil {
+				wallet.Transactions[j].Amount = amount
+			}
+		}
+	}
+}
+
+// migrateOpeningBalances turns balances without a ledger into an opening-balance entry
+func migrateOpeningBalances(budgetFile *BudgetFile, filename string) {
+	for i := range budgetFile.Wallets {
+		wallet := &budgetFile.Wallets[i]
+		if len(wallet.Transactions) > 0 || wallet.Balance.IsZero() {
+			continue
+		}
+		wallet.Transactions = []Transaction{{
+			Timestamp: budgetFile.CreatedAt,
+			Amount:    wallet.Balance,
+			Memo:      "Opening balance",
+			Kind:      TransactionOpening,
+		}}
+	}
+}
+
+func migrateWalletIDs(budgetFile *BudgetFile, filename string) {
+	assignWalletIDs(budgetFile)
+}
+
+// migrateEncryptionSupport leaves plain budgets as they are. The version bump
+// keeps older versions of the app from reading an encrypted budget as an empty
+// one and saving over it.
+func migrateEncryptionSupport(budgetFile *BudgetFile, filename string) {}
+
+// migrateCompactJournal drops the ledgers that journal entries used to keep
+// whole for every edited wallet, keeping only the entries each change added
+func migrateCompactJournal(budgetFile *BudgetFile, filename string) {
+	for i := range budgetFile.Journal {
+		for j, change := range budgetFile.Journal[i].Changes {
+			if change.Before == nil || change.After == nil || len(change.After.Transactions) < len(change.Before.Transactions) {
+				continue
+			}
+			budgetFile.Journal[i].Changes[j] = walletEdit(*change.Before, *change.After, change.Index)
+		}
+	}
+}
+
+// migrateCurrencyChanges finds the currency changes older versions recorded
+// only in the memo of a set entry, so past balances are replayed in the
+// currency the wallet had at the time
+func migrateCurrencyChanges(budgetFile *BudgetFile, filename string) {
+	for i := range budgetFile.Wallets {
+		ledger := budgetFile.Wallets[i].Transactions
+		for j := range ledger {
+			if ledger[j].Kind != TransactionSet || ledger[j].PreviousCurrency != "" {
+				continue
+			}
+			for _, prefix := range []string{"Currency changed from ", "Converted from "} {
+				if rest, ok := strings.CutPrefix(ledger[j].Memo, prefix); ok {
+					code, _, _ := strings.Cut(strings.TrimSuffix(rest, ", balance kept"), " ")
+					ledger[j].PreviousCurrency = code
+				}
+			}
+		}
+	}
+}
+
+// migrateFirstSnapshot starts the history with the balances as of the last update
+func migrateFirstSnapshot(budgetFile *BudgetFile, filename string) {
+	if len(budgetFile.Snapshots) > 0 || len(budgetFile.Wallets) == 0 {
+		return
+	}
+	recordSnapshot(budgetFile, budgetFile.UpdatedAt)
+}
+
+// OpenLogFile opens the log that records migrations and other background events
+func OpenLogFile() (*os.File, error) {
+	cacheDir := CurrentPaths().CacheDir
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(cacheDir, "budget.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMigrateLegacyBudget(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	dir := t.TempDir()
+	legacy := []byte(`{"wallets": [{"name": "Cash", "owner": "Sam", "type": "cash", "currency": "USD", "balance": 12.5}], "default_currency": "USD"}`)
+	filePath := filepath.Join(dir, "home.json")
+	if err := os.WriteFile(filePath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewDirStore(dir)
+	lock, err := s.Lock("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+
+	budget, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("schema version = %d, want %d", budget.SchemaVersion, CurrentSchemaVersion)
+	}
+	if budget.Name != "home" {
+		t.Errorf("name = %q, want the file name", budget.Name)
+	}
+	wallet := budget.Wallets[0]
+	if wallet.ID == "" {
+		t.Errorf("wallet has no ID")
+	}
+	if wallet.Balance.String() != "12.50" {
+		t.Errorf("balance = %s, want 12.50", wallet.Balance)
+	}
+	if len(wallet.Transactions) != 1 || wallet.Transactions[0].Kind != TransactionOpening {
+		t.Errorf("ledger = %+v, want an opening balance", wallet.Transactions)
+	}
+	if len(budget.Snapshots) != 1 {
+		t.Errorf("%d snapshots, want the first one", len(budget.Snapshots))
+	}
+
+	backup, err := os.ReadFile(filePath + ".v0.bak")
+	if err != nil {
+		t.Fatalf("no backup of the legacy file: %v", err)
+	}
+	if !bytes.Equal(backup, legacy) {
+		t.Errorf("backup differs from the legacy file")
+	}
+
+	// The upgrade was saved, so the next load neither migrates nor changes IDs
+	again, err := s.Load("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Wallets[0].ID != wallet.ID {
+		t.Errorf("wallet ID changed between loads")
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "home.json.v*.bak"))
+	if len(backups) != 1 {
+		t.Errorf("backups = %v, want only the v0 one", backups)
+	}
+}
+
+func TestMigrateFromEveryVersion(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	for version := 1; version < CurrentSchemaVersion; version++ {
+		content := []byte(`{"schema_version": ` + strconv.Itoa(version) + `, "name": "Home", "default_currency": "EUR",
+			"wallets": [{"id": "w1", "name": "Cash", "currency": "EUR", "balance": "10.00"}]}`)
+		budget, from, err := decodeBudgetFile(content, "home")
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if from != version || budget.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("version %d: decoded from %d to %d", version, from, budget.SchemaVersion)
+		}
+		if budget.Wallets[0].Balance.String() != "10.00" {
+			t.Errorf("version %d: balance = %s", version, budget.Wallets[0].Balance)
+		}
+	}
+}
+
+func TestNewerSchemaVersionIsNotOverwritten(t *testing.T) {
+	useTestHome(t, nil)
+
+	s := NewMemoryStore()
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored map[string]any
+	if err := json.Unmarshal(s.budgets[budget.Slug], &stored); err != nil {
+		t.Fatal(err)
+	}
+	stored["schema_version"] = CurrentSchemaVersion + 1
+	if s.budgets[budget.Slug], err = json.Marshal(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load(budget.Slug); err == nil || !strings.Contains(err.Error(), "update the app") {
+		t.Errorf("Load = %v, want a request to update the app", err)
+	}
+	if err := s.ForceSave(budget); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("ForceSave = %v, want a refusal", err)
+	}
+}
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot records a budget's balances as of one day. The store keeps at most
+// one per day: a later save on the same day replaces it.
+type Snapshot struct {
+	TakenAt  time.Time         `json:"taken_at"`
+	Balances []SnapshotBalance `json:"balances"`
+	Currency string            `json:"currency"` // DefaultCurrency when the snapshot was taken
+	Total    Money             `json:"total"`    // net worth: assets minus liabilities
+	// Wallets left out of Total because their currency couldn't be converted
+	Unconverted []string `json:"unconverted,omitempty"`
+}
+
+type SnapshotBalance struct {
+	WalletID  string `json:"wallet_id"`
+	Name      string `json:"name"`
+	Currency  string `json:"currency"`
+	Balance   Money  `json:"balance"`
+	Liability bool   `json:"liability,omitempty"` // counted against the total
+}
+
+// Complete reports whether every wallet was counted in the total
+func (s Snapshot) Complete() bool {
+	return len(s.Unconverted) == 0
+}
+
+func takeSnapshot(budgetFile *BudgetFile, at time.Time) Snapshot {
+	currency, _ := GetDefaultCurrency(budgetFile)
+	snapshot := Snapshot{TakenAt: at, Balances: []SnapshotBalance{}}
+
+	for _, wallet := range budgetFile.Wallets {
+		snapshot.Balances = append(snapshot.Balances, SnapshotBalance{
+			WalletID:  wallet.ID,
+			Name:      wallet.Name,
+			Currency:  wallet.Currency,
+			Balance:   wallet.Balance,
+			Liability: wallet.IsLiability(),
+		})
+	}
+
+	// Only stored rates: a save must not wait on the network. Wallets left
+	// unconverted are valued again by NetWorthHistory.
+	snapshot.value(currency, budgetFile.RateOverrides, false)
+	return snapshot
+}
+
+// value totals the balances in currency at the rates of the day the snapshot
+// was taken, so an old snapshot is valued with its own day's rates. Without
+// fetch only stored rates are used.
+func (s *Snapshot) value(currency string, overrides RateOverrides, fetch bool) {
+	s.Currency = currency
+	s.Total = NewMoney(0, CurrencyExponent(currency))
+	s.Unconverted = nil
+
+	for _, balance := range s.Balances {
+		amount := balance.Balance
+		if balance.Liability {
+			amount = amount.Neg()
+		}
+
+		converted, err := convert(amount, balance.Currency, currency, currency, overrides, s.TakenAt, fetch)
+		if err == nil {
+			converted, err = s.Total.Add(converted)
+		}
+		if err != nil {
+			s.Unconverted = append(s.Unconverted, balance.WalletID)
+			continue
+		}
+		s.Total = converted
+	}
+}
+
+// ValueAt values the budget as it stood at the end of a day: each wallet's
+// balance replayed from its ledger, in the currency it had that day, and
+// converted at that day's rates. Wallets deleted since are counted with their
+// balance in the last snapshot taken by then. An empty currency means the
+// budget's default currency.
+func ValueAt(budgetFile *BudgetFile, day time.Time, currency string) (Snapshot, error) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	if day.After(time.Now()) {
+		return Snapshot{}, fmt.Errorf("%s is in the future", day.Format(dateLayout))
+	}
+
+	if currency == "" {
+		defaultCurrency, err := GetDefaultCurrency(budgetFile)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		currency = defaultCurrency
+	}
+
+	snapshot := Snapshot{TakenAt: day, Balances: []SnapshotBalance{}}
+	end := day.AddDate(0, 0, 1)
+	for i := range budgetFile.Wallets {
+		wallet := &budgetFile.Wallets[i]
+		balance, walletCurrency, existed, err := wallet.BalanceAt(end)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("can't replay '%s': %w", wallet.Name, err)
+		}
+		if !existed {
+			continue
+		}
+		snapshot.Balances = append(snapshot.Balances, SnapshotBalance{
+			WalletID:  wallet.ID,
+			Name:      wallet.Name,
+			Currency:  walletCurrency,
+			Balance:   balance,
+			Liability: wallet.IsLiability(),
+		})
+	}
+	if stored, ok := lastSnapshotBefore(budgetFile, end); ok {
+		for _, balance := range stored.Balances {
+			if _, err := FindWallet(budgetFile, balance.WalletID); err != nil {
+				snapshot.Balances = append(snapshot.Balances, balance)
+			}
+		}
+	}
+
+	snapshot.value(currency, budgetFile.RateOverrides, true)
+	return snapshot, nil
+}
+
+// lastSnapshotBefore returns the newest snapshot taken before a time
+func lastSnapshotBefore(budgetFile *BudgetFile, before time.Time) (Snapshot, bool) {
+	for i := len(budgetFile.Snapshots) - 1; i >= 0; i-- {
+		if budgetFile.Snapshots[i].TakenAt.Before(before) {
+			return budgetFile.Snapshots[i], true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// recordSnapshot stores the budget's current balances as the snapshot for the
+// day of at, replacing one taken earlier that day
+func recordSnapshot(budgetFile *BudgetFile, at time.Time) {
+	snapshot := takeSnapshot(budgetFile, at)
+
+	last := len(budgetFile.Snapshots) - 1
+	if last >= 0 && sameDay(budgetFile.Snapshots[last].TakenAt, at) {
+		budgetFile.Snapshots[last] = snapshot
+		return
+	}
+	budgetFile.Snapshots = append(budgetFile.Snapshots, snapshot)
+}
+
+func sameDay(a, b time.Time) bool {
+	a, b = a.Local(), b.Local()
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// HistoryEntry is the net worth at the end of one day, week or month
+type HistoryEntry struct {
+	Period   string // e.g. "2024-03-15", "2024-W11" or "2024-03"
+	Snapshot Snapshot
+	// Change since the previous entry; only set when both totals are complete
+	// and in the same currency
+	Delta    Money
+	HasDelta bool
+}
+
+// periodKey names the day, ISO week or month a time falls in
+func periodKey(t time.Time, period string) (string, error) {
+	t = t.Local()
+	switch period {
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	default:
+		return "", fmt.Errorf("unknown period '%s', use day, week or month", period)
+	}
+}
+
+// NetWorthHistory groups the budget's snapshots by period, keeping the last
+// snapshot of each, oldest first. Snapshots that left wallets out or were
+// taken in another currency are valued again with their own day's rates.
+func NetWorthHistory(budgetFile *BudgetFile, period string) ([]HistoryEntry, error) {
+	currency, _ := GetDefaultCurrency(budgetFile)
+
+	var history []HistoryEntry
+	for _, snapshot := range budgetFile.Snapshots {
+		key, err := periodKey(snapshot.TakenAt, period)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(history) > 0 && history[len(history)-1].Period == key {
+			history[len(history)-1].Snapshot = snapshot
+		} else {
+			history = append(history, HistoryEntry{Period: key, Snapshot: snapshot})
+		}
+	}
+
+	for i := range history {
+		if snapshot := history[i].Snapshot; !snapshot.Complete() || snapshot.Currency != currency {
+			snapshot.value(currency, budgetFile.RateOverrides, true)
+			if snapshot.Complete() {
+				history[i].Snapshot = snapshot
+			}
+		}
+	}
+
+	for i := 1; i < len(history); i++ {
+		previous, current := history[i-1].Snapshot, history[i].Snapshot
+		if previous.Currency == current.Currency && previous.Complete() && current.Complete() {
+			delta, err := current.Total.Sub(previous.Total)
+			history[i].Delta, history[i].HasDelta = delta, err == nil
+		}
+	}
+
+	return history, nil
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveValuesSnapshotWithoutFetching(t *testing.T) {
+	provider := &stubRates{rates: map[string]float64{"USD": 1.25}}
+	useTestHome(t, provider)
+
+	s := NewMemoryStore()
+	budget, err := s.Create("Home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget.DefaultCurrency = "EUR"
+	if err := CreateWallet(s, budget, "Checking", "", "", "USD", NewMoney(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if provider.calls != 0 {
+		t.Fatalf("saving fetched rates %d times", provider.calls)
+	}
+	snapshot := budget.Snapshots[len(budget.Snapshots)-1]
+	if snapshot.Complete() {
+		t.Fatalf("snapshot counted the USD wallet without any stored rates")
+	}
+
+	history, err := NetWorthHistory(budget, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := history[len(history)-1].Snapshot.Total; total.Cmp(NewMoney(800, 0)) != 0 {
+		t.Errorf("history total = %s, want 800", total)
+	}
+
+	// Rates are cached now, so the next save values the snapshot
+	if err := AdjustWallet(s, budget, budget.Wallets[0].ID, NewMoney(250, 0), ""); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("rates fetched %d times, want 1", provider.calls)
+	}
+	snapshot = budget.Snapshots[len(budget.Snapshots)-1]
+	if !snapshot.Complete() || snapshot.Total.Cmp(NewMoney(1000, 0)) != 0 {
+		t.Errorf("snapshot total = %s (complete %v), want 1000", snapshot.Total, snapshot.Complete())
+	}
+}
+
+func TestValueAtUsesCurrencyOfTheDay(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	today := startOfDay(time.Now())
+	budget := &BudgetFile{DefaultCurrency: "EUR", Wallets: []Wallet{{
+		ID:       "w1",
+		Name:     "Savings",
+		Currency: "USD",
+		Balance:  NewMoney(12500, 2),
+		Transactions: []Transaction{
+			{Timestamp: today.AddDate(0, 0, -10), Amount: NewMoney(10000, 2), Kind: TransactionOpening},
+			{Timestamp: today.AddDate(0, 0, -5), Amount: NewMoney(12500, 2), Kind: TransactionSet, PreviousCurrency: "EUR"},
+		},
+	}}}
+
+	before, err := ValueAt(budget, today.AddDate(0, 0, -7), "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := before.Balances[0]; balance.Currency != "EUR" || balance.Balance.String() != "100.00" {
+		t.Errorf("before the change: %s %s, want 100.00 EUR", balance.Balance, balance.Currency)
+	}
+
+	after, err := ValueAt(budget, today.AddDate(0, 0, -3), "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := after.Balances[0]; balance.Currency != "USD" || balance.Balance.String() != "125.00" {
+		t.Errorf("after the change: %s %s, want 125.00 USD", balance.Balance, balance.Currency)
+	}
+	if after.Total.String() != "100.00" {
+		t.Errorf("total after the change = %s, want 100.00", after.Total)
+	}
+}
+
+func TestValueAtCountsDeletedWallets(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.25}})
+
+	today := startOfDay(time.Now())
+	budget := &BudgetFile{DefaultCurrency: "EUR", Wallets: []Wallet{}, Snapshots: []Snapshot{{
+		TakenAt:  today.AddDate(0, 0, -6).Add(12 * time.Hour),
+		Currency: "EUR",
+		Balances: []SnapshotBalance{{WalletID: "gone", Name: "Old account", Currency: "EUR", Balance: NewMoney(5000, 2)}},
+	}}}
+
+	snapshot, err := ValueAt(budget, today.AddDate(0, 0, -4), "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Balances) != 1 || snapshot.Total.String() != "50.00" {
+		t.Errorf("deleted wallet not counted: %+v", snapshot)
+	}
+
+	earlier, err := ValueAt(budget, today.AddDate(0, 0, -8), "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(earlier.Balances) != 0 {
+		t.Errorf("wallet counted before its first snapshot: %+v", earlier.Balances)
+	}
+}
+
+func TestMigrateCurrencyChanges(t *testing.T) {
+	budget := &BudgetFile{Wallets: []Wallet{{Transactions: []Transaction{
+		{Kind: TransactionOpening, Memo: "Opening balance"},
+		{Kind: TransactionSet, Memo: "Converted from EUR at 1.08"},
+		{Kind: TransactionSet, Memo: "Currency changed from USD, balance kept"},
+		{Kind: TransactionSet, Memo: "Corrected by hand"},
+	}}}}
+
+	migrateCurrencyChanges(budget, "home")
+
+	want := []string{"", "EUR", "USD", ""}
+	for i, tx := range budget.Wallets[0].Transactions {
+		if tx.PreviousCurrency != want[i] {
+			t.Errorf("entry %d (%q): previous currency %q, want %q", i, tx.Memo, tx.PreviousCurrency, want[i])
+		}
+	}
+}
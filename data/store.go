@@ -0,0 +1,166 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store persists budgets under their slug (see Slugify). DirStore keeps one
+// JSON file per budget, MemoryStore keeps them in memory for tests and
+// embedding, and EventLogStore appends every change to a single log file.
+type Store interface {
+	List() ([]BudgetFile, error)
+	Load(slug string) (*BudgetFile, error)
+	// Create validates the display name and stores the budget under its slug
+	Create(name string) (*BudgetFile, error)
+	// Save bumps the budget's revision and refuses with a *ConflictError
+	// if the stored copy has a newer revision than budgetFile.
+	Save(budgetFile *BudgetFile) error
+	// ForceSave writes the budget even if the stored copy is newer
+	ForceSave(budgetFile *BudgetFile) error
+	Delete(slug string) error
+	// Rename changes the display name and moves the budget to the matching slug
+	Rename(slug, newName string) error
+	// Unlock checks the passphrase of an encrypted budget and keeps its key,
+	// so Load can decrypt it. Until then List returns it Locked and Load
+	// fails with ErrPassphraseRequired.
+	Unlock(slug, passphrase string) error
+}
+
+// Locker is implemented by stores that can tell when another process has a budget open
+type Locker interface {
+	Lock(slug string) (*BudgetLock, error)
+}
+
+// ConflictError is returned by Store.Save when the stored budget has been
+// saved by someone else since budgetFile was loaded.
+type ConflictError struct {
+	Name         string
+	Revision     int64
+	DiskRevision int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("budget '%s' was changed elsewhere (revision %d on disk, %d loaded)", e.Name, e.DiskRevision, e.Revision)
+}
+
+// DefaultStore returns the JSON directory store in the configured data directory
+func DefaultStore() *DirStore {
+	return NewDirStore(CurrentPaths().DataDir)
+}
+
+// newBudgetFile validates a display name and returns an empty budget for it
+func newBudgetFile(name string) (*BudgetFile, error) {
+	if err := ValidateBudgetName(name); err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	now := time.Now()
+	return &BudgetFile{
+		SchemaVersion:   CurrentSchemaVersion,
+		Slug:            Slugify(name),
+		Name:            name,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Wallets:         []Wallet{},
+		DefaultCurrency: "USD", // Default fallback
+	}, nil
+}
+
+// prepareSave checks budgetFile against the revision and schema version
+// currently stored, stamps it with the next revision and records today's
+// snapshot. A copy written by a newer version of the app is never overwritten,
+// even with force, as this version would drop the fields it doesn't know.
+func prepareSave(budgetFile *BudgetFile, storedRevision int64, storedVersion int, force bool) error {
+	if budgetFile.Locked() {
+		return fmt.Errorf("budget '%s': %w", budgetFile.Name, ErrPassphraseRequired)
+	}
+	if storedVersion > CurrentSchemaVersion {
+		return fmt.Errorf("budget '%s' was saved by a newer version of the app (schema version %d, this app supports up to %d); please update the app", budgetFile.Name, storedVersion, CurrentSchemaVersion)
+	}
+	if storedRevision > budgetFile.Revision && !force {
+		return &ConflictError{Name: budgetFile.Name, Revision: budgetFile.Revision, DiskRevision: storedRevision}
+	}
+
+	budgetFile.Revision = max(budgetFile.Revision, storedRevision) + 1
+	budgetFile.SchemaVersion = CurrentSchemaVersion
+	budgetFile.UpdatedAt = time.Now()
+	recordSnapshot(budgetFile, budgetFile.UpdatedAt)
+	return nil
+}
+
+func encodeBudgetFile(budgetFile *BudgetFile) ([]byte, error) {
+	if budgetFile.Locked() {
+		return nil, fmt.Errorf("budget '%s': %w", budgetFile.Name, ErrPassphraseRequired)
+	}
+
+	jsonData, err := json.MarshalIndent(budgetFile, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal budget file: %v", err)
+	}
+
+	if budgetFile.Encrypted {
+		return sealBudget(budgetFile, jsonData)
+	}
+	return jsonData, nil
+}
+
+// readRevision returns the revision and schema version of an encoded budget,
+// encrypted or not
+func readRevision(content []byte) (revision int64, version int, err error) {
+	var header struct {
+		Revision      int64 `json:"revision"`
+		SchemaVersion int   `json:"schema_version"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return 0, 0, err
+	}
+	return header.Revision, header.SchemaVersion, nil
+}
+
+// loadBudget decodes a stored budget, upgrades it and repairs hand edits.
+// needsSave reports whether the stored copy should be rewritten. An encrypted
+// budget is decrypted with key; without a matching key it comes back Locked.
+func loadBudget(content []byte, slug string, key *budgetKey) (budgetFile *BudgetFile, fromVersion int, needsSave bool, err error) {
+	envelope, err := parseEncryptedBudget(content)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to parse budget file '%s': %v", slug, err)
+	}
+	if envelope != nil {
+		if !envelope.matches(key) {
+			// Never unlocked, or re-encrypted elsewhere with a new passphrase
+			return envelope.lockedBudget(slug), envelope.SchemaVersion, false, nil
+		}
+		content, err = envelope.open(key)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("failed to decrypt budget '%s': %v", slug, err)
+		}
+	}
+
+	budgetFile, fromVersion, err = decodeBudgetFile(content, slug)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	budgetFile.Slug = slug
+	if envelope != nil {
+		budgetFile.Encrypted = true
+		budgetFile.key = key
+	}
+
+	reconcileLedgers(budgetFile)
+	repaired := assignWalletIDs(budgetFile)
+	budgetFile.JournalPos = min(max(budgetFile.JournalPos, 0), len(budgetFile.Journal))
+
+	return budgetFile, fromVersion, fromVersion < CurrentSchemaVersion || repaired, nil
+}
+
+// sortByUpdated orders budgets with the most recently updated first
+func sortByUpdated(budgetFiles []BudgetFile) {
+	sort.Slice(budgetFiles, func(i, j int) bool {
+		return budgetFiles[i].UpdatedAt.After(budgetFiles[j].UpdatedAt)
+	})
+}
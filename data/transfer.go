@@ -0,0 +1,164 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	RateSourceMarket = "market"
+	RateSourceManual = "manual"
+	// RateSourceOverride marks a rate taken from the budget's overrides
+	RateSourceOverride = "override"
+)
+
+// ErrInsufficientFunds is returned for a transfer an asset wallet can't cover,
+// or that would take a liability past its credit limit
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// TransferFunds moves amount, in the source wallet's currency, to another
+// wallet and charges fee to the source on top. The destination is credited at
+// rate, or at the market rate if rate is 0; a rate can only be given between
+// different currencies. Both wallets change in a single save. It returns the
+// transaction posted to the destination.
+//
+// Liabilities hold the amount owed, so paying into one lowers its balance
+// and paying out of one, like a cash advance, raises it.
+func TransferFunds(s Store, data *BudgetFile, fromID, toID string, amount, fee Money, rate float64) (Transaction, error) {
+	if fromID == toID {
+		return Transaction{}, fmt.Errorf("can't transfer a wallet to itself")
+	}
+	if amount.Sign() <= 0 {
+		return Transaction{}, fmt.Errorf("transfer amount must be positive")
+	}
+	if fee.Sign() < 0 {
+		return Transaction{}, fmt.Errorf("fee can't be negative")
+	}
+	if rate < 0 {
+		return Transaction{}, fmt.Errorf("rate must be positive")
+	}
+
+	fromIndex, err := FindWallet(data, fromID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	toIndex, err := FindWallet(data, toID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	from, to := &data.Wallets[fromIndex], &data.Wallets[toIndex]
+
+	total, err := amount.Add(fee)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := checkFunds(*from, total); err != nil {
+		return Transaction{}, err
+	}
+
+	rateSource := RateSourceManual
+	if from.Currency == to.Currency {
+		if rate != 0 {
+			return Transaction{}, fmt.Errorf("both wallets are in %s, so the transfer can't have a rate", from.Currency)
+		}
+		rate, rateSource = 1, RateSourceMarket
+	} else if rate == 0 {
+		defaultCurrency, err := GetDefaultCurrency(data)
+		if err != nil {
+			return Transaction{}, err
+		}
+		rate, err = ExchangeRate(from.Currency, to.Currency, defaultCurrency, data.RateOverrides)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("failed to get the %s to %s exchange rate: %v", from.Currency, to.Currency, err)
+		}
+		rateSource = data.RateOverrides.source(from.Currency, to.Currency, defaultCurrency)
+	}
+
+	transferID := newID()
+	debit := Transaction{
+		Amount:       amount.Neg(),
+		Memo:         fmt.Sprintf("Transfer to %s", to.Name),
+		Kind:         TransactionTransfer,
+		TransferID:   transferID,
+		Counterparty: to.ID,
+		Rate:         rate,
+		RateSource:   rateSource,
+	}
+	converted, err := amount.MulRate(rate, CurrencyExponent(to.Currency))
+	if err != nil {
+		return Transaction{}, fmt.Errorf("can't convert %s %s to %s: %w", amount, from.Currency, to.Currency, err)
+	}
+	credit := Transaction{
+		Amount:       converted,
+		Memo:         fmt.Sprintf("Transfer from %s", from.Name),
+		Kind:         TransactionTransfer,
+		TransferID:   transferID,
+		Counterparty: from.ID,
+		Rate:         rate,
+		RateSource:   rateSource,
+	}
+
+	if from.IsLiability() {
+		debit.Amount = debit.Amount.Neg()
+	}
+	if to.IsLiability() {
+		credit.Amount = credit.Amount.Neg()
+	}
+
+	description := fmt.Sprintf("transfer %s %s from '%s' to '%s'", amount, from.Currency, from.Name, to.Name)
+	err = data.journal(description, func() error {
+		if _, err := from.record(debit); err != nil {
+			return err
+		}
+		if !fee.IsZero() {
+			feeAmount := fee.Neg()
+			if from.IsLiability() {
+				feeAmount = fee
+			}
+			_, err := from.record(Transaction{
+				Amount:       feeAmount,
+				Memo:         fmt.Sprintf("Fee for transfer to %s", to.Name),
+				Kind:         TransactionFee,
+				TransferID:   transferID,
+				Counterparty: to.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		credit, err = to.record(credit)
+		return err
+	})
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if err := s.Save(data); err != nil {
+		return Transaction{}, err
+	}
+	return credit, nil
+}
+
+// checkFunds reports whether a wallet can pay out total: an asset wallet up to
+// its balance, a liability up to its credit limit if it has one
+func checkFunds(wallet Wallet, total Money) error {
+	if wallet.IsLiability() {
+		if wallet.CreditLimit == nil {
+			return nil
+		}
+		owed, err := wallet.Balance.Add(total)
+		if err != nil {
+			return err
+		}
+		if owed.Cmp(*wallet.CreditLimit) > 0 {
+			return fmt.Errorf("%w: '%s' would owe %s, over its %s credit limit", ErrInsufficientFunds, wallet.Name, owed, *wallet.CreditLimit)
+		}
+		return nil
+	}
+
+	if total.Cmp(wallet.Balance) > 0 {
+		return fmt.Errorf("%w: '%s' has %s, the transfer needs %s", ErrInsufficientFunds, wallet.Name, wallet.Balance, total)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTransferBudget adds EUR, USD and JPY wallets and a EUR credit card with
+// a 50.00 limit to the test budget, and returns their IDs by name
+func newTransferBudget(t *testing.T) (*MemoryStore, *BudgetFile, map[string]string) {
+	t.Helper()
+
+	s, budget, _ := newTestBudget(t)
+	for _, w := range []struct{ name, walletType, currency string }{
+		{"Savings", "bank", "EUR"},
+		{"Dollars", "bank", "USD"},
+		{"Yen", "cash", "JPY"},
+		{"Card", TypeCreditCard, "EUR"},
+	} {
+		if err := CreateWallet(s, budget, w.name, "", w.walletType, w.currency, NewMoney(0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := make(map[string]string)
+	for _, wallet := range budget.Wallets {
+		ids[wallet.Name] = wallet.ID
+	}
+	if err := SetCreditLimit(s, budget, ids["Card"], NewMoney(5000, 2)); err != nil {
+		t.Fatal(err)
+	}
+	return s, budget, ids
+}
+
+func TestTransferFunds(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, to    string
+		amount, fee string
+		rate        float64
+		wantCredit  string
+		wantErr     string
+	}{
+		{name: "same currency", from: "Checking", to: "Savings", amount: "10", wantCredit: "10.00"},
+		{name: "market rate", from: "Checking", to: "Dollars", amount: "10", wantCredit: "12.35"},
+		{name: "rounds half away from zero", from: "Checking", to: "Dollars", amount: "0.03", rate: 1.5, wantCredit: "0.05"},
+		{name: "to a currency without decimals", from: "Checking", to: "Yen", amount: "10", rate: 161.237, wantCredit: "1612"},
+		{name: "from a credit card within its limit", from: "Card", to: "Checking", amount: "40", fee: "1", wantCredit: "40.00"},
+		{name: "all the balance", from: "Checking", to: "Savings", amount: "99", fee: "1", wantCredit: "99.00"},
+		{name: "more than the balance", from: "Checking", to: "Savings", amount: "100", fee: "0.01", wantErr: "insufficient funds"},
+		{name: "past the credit limit", from: "Card", to: "Checking", amount: "50.01", wantErr: "insufficient funds"},
+		{name: "rate between the same currency", from: "Checking", to: "Savings", amount: "10", rate: 1.1, wantErr: "can't have a rate"},
+		{name: "to itself", from: "Checking", to: "Checking", amount: "10", wantErr: "to itself"},
+		{name: "zero amount", from: "Checking", to: "Savings", amount: "0", wantErr: "must be positive"},
+		{name: "negative fee", from: "Checking", to: "Savings", amount: "10", fee: "-1", wantErr: "fee can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHome(t, &stubRates{rates: map[string]float64{"USD": 1.23456, "JPY": 160}})
+			s, budget, ids := newTransferBudget(t)
+
+			amount, err := ParseMoney(tt.amount, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fee := NewMoney(0, 2)
+			if tt.fee != "" {
+				if fee, err = ParseMoney(tt.fee, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+			journaled := len(budget.Journal)
+
+			credit, err := TransferFunds(s, budget, ids[tt.from], ids[tt.to], amount, fee, tt.rate)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if len(budget.Journal) != journaled || budget.Wallets[0].Balance.String() != "100.00" {
+					t.Errorf("failed transfer changed the budget")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if credit.Amount.String() != tt.wantCredit {
+				t.Errorf("credited %s, want %s", credit.Amount, tt.wantCredit)
+			}
+
+			// Both legs and the fee share one transfer ID and one undo step
+			from := budget.Wallets[mustFind(t, budget, ids[tt.from])]
+			legs := 0
+			for _, tx := range from.Transactions {
+				if tx.TransferID == credit.TransferID {
+					legs++
+				}
+			}
+			want := 1
+			if !fee.IsZero() {
+				want = 2
+			}
+			if legs != want {
+				t.Errorf("%d entries in the source for the transfer, want %d", legs, want)
+			}
+			if len(budget.Journal) != journaled+1 {
+				t.Errorf("%d journal entries added, want 1", len(budget.Journal)-journaled)
+			}
+		})
+	}
+}
+
+func mustFind(t *testing.T, budget *BudgetFile, id string) int {
+	t.Helper()
+	index, err := FindWallet(budget, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// UnitKind says what a unit measures and where its rates come from. Fiat
+// rates come from the exchange rate APIs; every other kind is priced through
+// its own manual rate or the price file.
+type UnitKind string
+
+const (
+	UnitFiat      UnitKind = "fiat"
+	UnitCrypto    UnitKind = "crypto"
+	UnitCommodity UnitKind = "commodity"
+	UnitCustom    UnitKind = "custom"
+)
+
+// maxPrecision keeps amounts in range: Money holds minor units in an int64
+const maxPrecision = 8
+
+// Unit is anything a wallet can be denominated in
+type Unit struct {
+	Code      string   `json:"code"`
+	Name      string   `json:"name"`
+	Precision int      `json:"precision"` // decimal places amounts are kept with
+	Kind      UnitKind `json:"kind"`
+	Symbol    string   `json:"symbol,omitempty"`
+
+	// A manual rate for user-defined units: one unit is worth Rate of RateCurrency
+	Rate         float64 `json:"rate,omitempty"`
+	RateCurrency string  `json:"rate_currency,omitempty"`
+}
+
+// builtinUnits are the non-fiat units everyone gets. Fiat currencies come
+// from isoCurrencies.
+var builtinUnits = []Unit{
+	{Code: "BTC", Name: "Bitcoin", Precision: 8, Kind: UnitCrypto, Symbol: "₿"},
+	{Code: "ETH", Name: "Ether", Precision: 8, Kind: UnitCrypto, Symbol: "Ξ"},
+	{Code: "SOL", Name: "Solana", Precision: 8, Kind: UnitCrypto},
+	{Code: "USDT", Name: "Tether", Precision: 6, Kind: UnitCrypto},
+	{Code: "USDC", Name: "USD Coin", Precision: 6, Kind: UnitCrypto},
+	{Code: "XAU", Name: "Gold (troy ounce)", Precision: 4, Kind: UnitCommodity},
+	{Code: "XAG", Name: "Silver (troy ounce)", Precision: 4, Kind: UnitCommodity},
+	{Code: "XPT", Name: "Platinum (troy ounce)", Precision: 4, Kind: UnitCommodity},
+	{Code: "XPD", Name: "Palladium (troy ounce)", Precision: 4, Kind: UnitCommodity},
+}
+
+// ErrUnknownUnit is returned for a code that is neither a known currency nor a registered unit
+var ErrUnknownUnit = errors.New("unknown currency or unit")
+
+// customUnits are the user's own units, kept in units.json in the config directory
+var customUnits struct {
+	mu     sync.Mutex
+	loaded bool
+	units  []Unit
+}
+
+func unitsPath() string {
+	return filepath.Join(CurrentPaths().ConfigDir, "units.json")
+}
+
+// loadCustomUnits reads units.json once; the caller holds customUnits.mu
+func loadCustomUnits() []Unit {
+	if customUnits.loaded {
+		return customUnits.units
+	}
+	customUnits.loaded = true
+
+	file, err := os.ReadFile(unitsPath())
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(file, &customUnits.units); err != nil {
+		log.Printf("ignoring %s: %v", unitsPath(), err)
+		customUnits.units = nil
+	}
+	return customUnits.units
+}
+
+func saveCustomUnits(units []Unit) error {
+	path := unitsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(units, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, content, 0644); err != nil {
+		return err
+	}
+
+	customUnits.units = units
+	return nil
+}
+
+// normalizeUnitCode upper-cases a code and checks its shape: 2 to 10 letters or digits
+func normalizeUnitCode(code string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(code))
+
+	if len(normalized) < 2 || len(normalized) > 10 {
+		return "", fmt.Errorf("unit code must be 2 to 10 characters, got '%s'", code)
+	}
+	for _, char := range normalized {
+		if (char < 'A' || char > 'Z') && (char < '0' || char > '9') {
+			return "", fmt.Errorf("unit code must contain only letters and digits, got '%s'", code)
+		}
+	}
+
+	return normalized, nil
+}
+
+// LookupUnit finds a unit by code among the ISO 4217 currencies, the other
+// currencies the rate providers quote, and the built-in and custom units.
+func LookupUnit(code string) (Unit, error) {
+	code, err := normalizeUnitCode(code)
+	if err != nil {
+		return Unit{}, err
+	}
+
+	if i := slices.IndexFunc(builtinUnits, func(u Unit) bool { return u.Code == code }); i >= 0 {
+		return builtinUnits[i], nil
+	}
+	if iso, ok := isoCurrencies[code]; ok {
+		return Unit{Code: code, Name: iso.name, Precision: iso.minor, Kind: UnitFiat, Symbol: iso.symbol}, nil
+	}
+	if other, ok := providerCurrencies[code]; ok {
+		return Unit{Code: code, Name: other.name, Precision: other.minor, Kind: UnitFiat, Symbol: other.symbol}, nil
+	}
+
+	customUnits.mu.Lock()
+	defer customUnits.mu.Unlock()
+	units := loadCustomUnits()
+	if i := slices.IndexFunc(units, func(u Unit) bool { return u.Code == code }); i >= 0 {
+		return units[i], nil
+	}
+
+	return Unit{}, fmt.Errorf("%w '%s'", ErrUnknownUnit, code)
+}
+
+// ListUnits returns the built-in units followed by the custom ones
+func ListUnits() []Unit {
+	customUnits.mu.Lock()
+	defer customUnits.mu.Unlock()
+	return append(slices.Clone(builtinUnits), loadCustomUnits()...)
+}
+
+// AddCustomUnit registers a unit of the user's own, or updates it if the code
+// is already custom. rate and rateCurrency are optional: without them the
+// unit is priced from the price file.
+func AddCustomUnit(code, name string, precision int, rate float64, rateCurrency string) (Unit, error) {
+	code, err := normalizeUnitCode(code)
+	if err != nil {
+		return Unit{}, err
+	}
+	if precision < 0 || precision > maxPrecision {
+		return Unit{}, fmt.Errorf("precision must be between 0 and %d", maxPrecision)
+	}
+	if rate < 0 {
+		return Unit{}, fmt.Errorf("rate can't be negative")
+	}
+	if rate > 0 {
+		quoted, err := LookupUnit(rateCurrency)
+		if err != nil || quoted.Kind != UnitFiat {
+			return Unit{}, fmt.Errorf("a rate must be given in a fiat currency, not '%s'", rateCurrency)
+		}
+		rateCurrency = quoted.Code
+	} else {
+		rateCurrency = ""
+	}
+
+	if slices.ContainsFunc(builtinUnits, func(u Unit) bool { return u.Code == code }) {
+		return Unit{}, fmt.Errorf("%s is a built-in unit", code)
+	}
+	_, iso := isoCurrencies[code]
+	if _, other := providerCurrencies[code]; iso || other {
+		return Unit{}, fmt.Errorf("%s is a fiat currency", code)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = code
+	}
+	unit := Unit{Code: code, Name: name, Precision: precision, Kind: UnitCustom, Rate: rate, RateCurrency: rateCurrency}
+
+	customUnits.mu.Lock()
+	defer customUnits.mu.Unlock()
+	units := slices.Clone(loadCustomUnits())
+	if i := slices.IndexFunc(units, func(u Unit) bool { return u.Code == code }); i >= 0 {
+		units[i] = unit
+	} else {
+		units = append(units, unit)
+	}
+	return unit, saveCustomUnits(units)
+}
+
+// RemoveCustomUnit forgets a custom unit. Wallets already in it keep the
+// code but drop out of converted totals.
+func RemoveCustomUnit(code string) error {
+	code, err := normalizeUnitCode(code)
+	if err != nil {
+		return err
+	}
+
+	customUnits.mu.Lock()
+	defer customUnits.mu.Unlock()
+	units := slices.Clone(loadCustomUnits())
+	i := slices.IndexFunc(units, func(u Unit) bool { return u.Code == code })
+	if i < 0 {
+		return fmt.Errorf("%s is not a custom unit", code)
+	}
+	return saveCustomUnits(slices.Delete(units, i, i+1))
+}
+
+// unitQuote returns what one unit of a non-fiat unit is worth in a fiat
+// currency, from its manual rate or else from the price file
+func unitQuote(unit Unit) (float64, string, error) {
+	if unit.Rate > 0 {
+		return unit.Rate, unit.RateCurrency, nil
+	}
+
+	price, err := DefaultPriceFile().Price(unit.Code)
+	if err != nil {
+		if unit.Kind == UnitCustom {
+			return 0, "", fmt.Errorf("no rate for %s: give it one or add it to the price file", unit.Code)
+		}
+		return 0, "", fmt.Errorf("no rate for %s: add it to the price file", unit.Code)
+	}
+	if price.Currency == "" {
+		return 0, "", fmt.Errorf("the price of %s in the price file needs a currency", unit.Code)
+	}
+	if quoted, err := LookupUnit(price.Currency); err != nil || quoted.Kind != UnitFiat {
+		return 0, "", fmt.Errorf("the price of %s must be in a fiat currency, not %s", unit.Code, price.Currency)
+	}
+	if price.Value.Sign() <= 0 {
+		return 0, "", fmt.Errorf("the price of %s in the price file is zero", unit.Code)
+	}
+	return price.Value.Float64(), price.Currency, nil
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLookupUnit(t *testing.T) {
+	useTestHome(t, nil)
+
+	tests := []struct {
+		code      string
+		kind      UnitKind
+		precision int
+	}{
+		{"usd", UnitFiat, 2},
+		{"JPY", UnitFiat, 0},
+		{"KWD", UnitFiat, 3},
+		{"BTC", UnitCrypto, 8},
+		// Quoted by rate APIs but missing from ISO 4217
+		{"GGP", UnitFiat, 2},
+		{"XDR", UnitFiat, 2},
+		{"FOK", UnitFiat, 2},
+		{"SLL", UnitFiat, 2},
+		{"ZWL", UnitFiat, 2},
+	}
+	for _, tt := range tests {
+		unit, err := LookupUnit(tt.code)
+		if err != nil {
+			t.Errorf("LookupUnit(%q): %v", tt.code, err)
+			continue
+		}
+		if unit.Kind != tt.kind || unit.Precision != tt.precision {
+			t.Errorf("LookupUnit(%q) = %s with %d decimals, want %s with %d", tt.code, unit.Kind, unit.Precision, tt.kind, tt.precision)
+		}
+	}
+
+	// Typos of real codes stay unknown
+	for _, code := range []string{"ABCD", "A1B", "USSD", "EUD", "USF"} {
+		if _, err := LookupUnit(code); !errors.Is(err, ErrUnknownUnit) {
+			t.Errorf("LookupUnit(%q) = %v, want ErrUnknownUnit", code, err)
+		}
+	}
+}
+
+func TestExchangeRateForCodesOutsideISO(t *testing.T) {
+	useTestHome(t, &stubRates{rates: map[string]float64{"GBP": 0.85, "GGP": 0.85}})
+
+	rate, err := ExchangeRate("GGP", "GBP", "EUR", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-1) > 1e-9 {
+		t.Errorf("GGP to GBP = %v, want 1", rate)
+	}
+}
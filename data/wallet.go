@@ -1,21 +1,25 @@
 package data
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"os"
-	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 )
 
 type Wallet struct {
-	Name     string  `json:"name"`
-	Owner    string  `json:"owner"`
-	Type     string  `json:"type"`
-	Currency string  `json:"currency"`
-	Balance  float64 `json:"balance"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+	Balance  Money  `json:"balance"`
+	// For liabilities, see IsLiability: the most that can be owed
+	CreditLimit *Money `json:"credit_limit,omitempty"`
+	// Positions valued into the balance, see RevalueHoldings
+	Holdings     []Holding     `json:"holdings,omitempty"`
+	Transactions []Transaction `json:"transactions,omitempty"`
 }
 
 type BudgetData struct {
@@ -24,158 +28,57 @@ type BudgetData struct {
 }
 
 type BudgetFile struct {
+	SchemaVersion   int       `json:"schema_version"`
+	Slug            string    `json:"-"` // name the budget is stored under, set by the Store
 	Name            string    `json:"name"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	Revision        int64     `json:"revision"`
 	Wallets         []Wallet  `json:"wallets"`
 	DefaultCurrency string    `json:"default_currency"`
+	// Daily record of balances and net worth, oldest first
+	Snapshots []Snapshot      `json:"snapshots,omitempty"`
+	Recurring []RecurringRule `json:"recurring,omitempty"`
+	// Prices entered with SetPrice, by symbol
+	Prices map[string]Price `json:"prices,omitempty"`
+	// Exchange rates fixed by hand, see SetRateOverride
+	RateOverrides RateOverrides `json:"rate_overrides,omitempty"`
+	// Changes that can be undone; entries from JournalPos on were undone and can be redone
+	Journal    []JournalEntry `json:"journal,omitempty"`
+	JournalPos int            `json:"journal_pos,omitempty"`
+
+	Encrypted bool       `json:"-"` // stored encrypted, see EncryptBudget
+	key       *budgetKey // set once an encrypted budget is unlocked
 }
 
-func GetFilesDir() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".budget")
+// Locked reports whether the budget is encrypted and was listed without its
+// passphrase, so only its name and dates are known
+func (b *BudgetFile) Locked() bool {
+	return b.Encrypted && b.key == nil
 }
 
-func ListBudgetFiles() ([]BudgetFile, error) {
-	budgetsDir := filepath.Join(GetFilesDir(), "files")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(budgetsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create budgets directory: %v", err)
-	}
-
-	// Read directory contents
-	files, err := os.ReadDir(budgetsDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read budgets directory: %v", err)
-	}
-
-	var budgetFiles []BudgetFile
-	for _, file := range files {
-		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
-			filename := strings.TrimSuffix(file.Name(), ".json")
-			budgetFile, err := LoadBudgetFile(filename)
-			if err != nil {
-				// Skip files that can't be loaded
-				continue
-			}
-			budgetFiles = append(budgetFiles, *budgetFile)
-		}
-	}
-
-	// Sort by UpdatedAt (most recent first)
-	sort.Slice(budgetFiles, func(i, j int) bool {
-		return budgetFiles[i].UpdatedAt.After(budgetFiles[j].UpdatedAt)
-	})
-
-	return budgetFiles, nil
+// newID returns a random identifier for wallets and transfers. It stays with them for their lifetime.
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-func LoadBudgetFile(filename string) (*BudgetFile, error) {
-	budgetsDir := filepath.Join(GetFilesDir(), "files")
-	filePath := filepath.Join(budgetsDir, filename+".json")
-
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("budget file '%s' does not exist", filename)
-	}
-
-	file, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read budget file '%s': %v", filename, err)
-	}
-
-	// Try to parse as new BudgetFile format first
-	var budgetFile BudgetFile
-	if err := json.Unmarshal(file, &budgetFile); err == nil && budgetFile.Name != "" {
-		return &budgetFile, nil
-	}
-
-	// Fall back to old BudgetData format for backward compatibility
-	var oldData BudgetData
-	if err := json.Unmarshal(file, &oldData); err != nil {
-		return nil, fmt.Errorf("failed to parse budget file '%s' in any known format: %v", filename, err)
-	}
-
-	// Convert old format to new format
-	now := time.Now()
-	newBudgetFile := &BudgetFile{
-		Name:            filename,
-		CreatedAt:       now,
-		UpdatedAt:       now,
-		Wallets:         oldData.Wallets,
-		DefaultCurrency: oldData.DefaultCurrency,
-	}
-
-	// If no default currency, try to infer from first wallet
-	if newBudgetFile.DefaultCurrency == "" && len(newBudgetFile.Wallets) > 0 {
-		newBudgetFile.DefaultCurrency = newBudgetFile.Wallets[0].Currency
-	}
-
-	// Save in new format for future use
-	SaveBudgetFile(newBudgetFile)
-
-	return newBudgetFile, nil
-}
-
-func CreateBudgetFile(filename string) error {
-	budgetsDir := filepath.Join(GetFilesDir(), "files")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(budgetsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create budgets directory: %v", err)
-	}
-
-	filePath := filepath.Join(budgetsDir, filename+".json")
-
-	// Check if file already exists
-	if _, err := os.Stat(filePath); err == nil {
-		return fmt.Errorf("budget file '%s' already exists", filename)
-	}
-
-	now := time.Now()
-	budgetFile := BudgetFile{
-		Name:            filename,
-		CreatedAt:       now,
-		UpdatedAt:       now,
-		Wallets:         []Wallet{},
-		DefaultCurrency: "USD", // Default fallback
-	}
-
-	jsonData, err := json.MarshalIndent(budgetFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal budget file: %v", err)
-	}
-
-	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write budget file '%s': %v", filename, err)
-	}
-
-	return nil
-}
-
-func SaveBudgetFile(budgetFile *BudgetFile) error {
-	budgetsDir := filepath.Join(GetFilesDir(), "files")
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(budgetsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create budgets directory: %v", err)
-	}
-
-	filePath := filepath.Join(budgetsDir, budgetFile.Name+".json")
-
-	// Update the timestamp
-	budgetFile.UpdatedAt = time.Now()
-
-	jsonData, err := json.MarshalIndent(budgetFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal budget file: %v", err)
-	}
-
-	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write budget file '%s': %v", budgetFile.Name, err)
+// assignWalletIDs gives wallets from older files an ID and fixes duplicates
+// left behind by copying wallets around by hand.
+// It reports whether any wallet was changed.
+func assignWalletIDs(budgetFile *BudgetFile) bool {
+	changed := false
+	seen := make(map[string]bool)
+	for i := range budgetFile.Wallets {
+		wallet := &budgetFile.Wallets[i]
+		if wallet.ID == "" || seen[wallet.ID] {
+			wallet.ID = newID()
+			changed = true
+		}
+		seen[wallet.ID] = true
 	}
-
-	return nil
+	return changed
 }
 
 func GetExistingCurrencies(data *BudgetFile) []string {
@@ -203,119 +106,244 @@ func GetDefaultCurrency(data *BudgetFile) (string, error) {
 	return "", fmt.Errorf("no default currency set and no wallets exist")
 }
 
-func SetDefaultCurrency(currency string, data *BudgetFile) error {
-	data.DefaultCurrency = currency
-	return SaveBudgetFile(data)
-}
+func SetDefaultCurrency(s Store, currency string, data *BudgetFile) error {
+	description := fmt.Sprintf("set default currency to %s", currency)
+	if data.DefaultCurrency != "" {
+		description += fmt.Sprintf(" (was %s)", data.DefaultCurrency)
+	}
 
-func CreateWallet(filename, name, owner, walletType, currency string, balance float64) error {
-	data, err := LoadBudgetFile(filename)
+	err := data.journal(description, func() error {
+		data.DefaultCurrency = currency
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	return s.Save(data)
+}
 
+func CreateWallet(s Store, data *BudgetFile, name, owner, walletType, currency string, balance Money) error {
 	for _, wallet := range data.Wallets {
 		if wallet.Name == name {
 			return fmt.Errorf("wallet with name '%s' already exists", name)
 		}
 	}
 
-	currency, validationErr := normalizeCurrency(currency)
+	unit, validationErr := LookupUnit(currency)
 	if validationErr != nil {
 		return fmt.Errorf("invalid currency: %v", validationErr)
 	}
+	currency = unit.Code
 
 	newWallet := Wallet{
+		ID:       newID(),
 		Name:     name,
 		Owner:    owner,
 		Type:     walletType,
 		Currency: currency,
-		Balance:  balance,
 	}
+	if !balance.IsZero() {
+		if err := newWallet.post(TransactionOpening, balance, "Opening balance"); err != nil {
+			return fmt.Errorf("invalid opening balance: %w", err)
+		}
+	}
+
+	err := data.journal(fmt.Sprintf("create wallet '%s'", name), func() error {
+		data.Wallets = append(data.Wallets, newWallet)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
+}
 
-	data.Wallets = append(data.Wallets, newWallet)
-	return SaveBudgetFile(data)
+// FindWallet returns the position of the wallet with the given ID
+func FindWallet(data *BudgetFile, id string) (int, error) {
+	for i, wallet := range data.Wallets {
+		if wallet.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("wallet '%s' not found", id)
 }
 
-func AdjustWalletByIndex(filename string, index int, amount float64) error {
-	data, err := LoadBudgetFile(filename)
+func AdjustWallet(s Store, data *BudgetFile, id string, amount Money, memo string) error {
+	index, err := FindWallet(data, id)
 	if err != nil {
 		return err
 	}
 
-	if index < 0 || index >= len(data.Wallets) {
-		return fmt.Errorf("wallet index %d is out of range (0-%d)", index, len(data.Wallets)-1)
+	wallet := &data.Wallets[index]
+	description := fmt.Sprintf("adjust '%s' by %s%s", wallet.Name, signPrefix(amount), amount)
+	err = data.journal(description, func() error {
+		return wallet.post(TransactionAdjust, amount, memo)
+	})
+	if err != nil {
+		return err
 	}
-
-	data.Wallets[index].Balance += amount
-	return SaveBudgetFile(data)
+	return s.Save(data)
 }
 
-func SetWalletBalanceByIndex(filename string, index int, balance float64) error {
-	data, err := LoadBudgetFile(filename)
+func SetWalletBalance(s Store, data *BudgetFile, id string, balance Money, memo string) error {
+	index, err := FindWallet(data, id)
 	if err != nil {
 		return err
 	}
 
-	if index < 0 || index >= len(data.Wallets) {
-		return fmt.Errorf("wallet index %d is out of range (0-%d)", index, len(data.Wallets)-1)
+	wallet := &data.Wallets[index]
+	description := fmt.Sprintf("set '%s' balance to %s (was %s)", wallet.Name, balance, wallet.Balance)
+	err = data.journal(description, func() error {
+		return wallet.post(TransactionSet, balance, memo)
+	})
+	if err != nil {
+		return err
 	}
-
-	data.Wallets[index].Balance = balance
-	return SaveBudgetFile(data)
+	return s.Save(data)
 }
 
-func DeleteWalletByIndex(filename string, index int) error {
-	data, err := LoadBudgetFile(filename)
+// EditWallet renames a wallet and changes its owner, type or currency. On a
+// currency change the balance, credit limit and holdings are converted at
+// the current rate when convert is set, and keep their numbers otherwise.
+func EditWallet(s Store, data *BudgetFile, id, name, owner, walletType, currency string, convert bool) error {
+	index, err := FindWallet(data, id)
 	if err != nil {
 		return err
 	}
 
-	if index < 0 || index >= len(data.Wallets) {
-		return fmt.Errorf("wallet index %d is out of range (0-%d)", index, len(data.Wallets)-1)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("wallet name can't be empty")
+	}
+	for _, wallet := range data.Wallets {
+		if wallet.Name == name && wallet.ID != id {
+			return fmt.Errorf("wallet with name '%s' already exists", name)
+		}
 	}
 
-	data.Wallets = append(data.Wallets[:index], data.Wallets[index+1:]...)
-	return SaveBudgetFile(data)
-}
+	unit, err := LookupUnit(currency)
+	if err != nil {
+		return fmt.Errorf("invalid currency: %v", err)
+	}
+	currency = unit.Code
 
-func DeleteBudgetFile(filename string) error {
-	budgetsDir := filepath.Join(GetFilesDir(), "files")
-	filePath := filepath.Join(budgetsDir, filename+".json")
+	wallet := &data.Wallets[index]
+	oldCurrency := wallet.Currency
+	exp := CurrencyExponent(currency)
+	rate, rateSource := 1.0, RateSourceMarket
+	if currency != oldCurrency && convert {
+		base, err := GetDefaultCurrency(data)
+		if err != nil {
+			return err
+		}
+		if rate, err = ExchangeRate(oldCurrency, currency, base, data.RateOverrides); err != nil {
+			return fmt.Errorf("can't convert %s to %s: %v", oldCurrency, currency, err)
+		}
+		rateSource = data.RateOverrides.source(oldCurrency, currency, base)
+	}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("budget file '%s' does not exist", filename)
+	description := fmt.Sprintf("edit wallet '%s'", wallet.Name)
+	if name != wallet.Name {
+		description = fmt.Sprintf("rename wallet '%s' to '%s'", wallet.Name, name)
 	}
+	err = data.journal(description, func() error {
+		wallet.Name = name
+		wallet.Owner = owner
+		wallet.Type = walletType
+		if currency == oldCurrency {
+			return nil
+		}
 
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete budget file '%s': %v", filename, err)
+		wallet.Currency = currency
+		balance, err := wallet.Balance.MulRate(rate, exp)
+		if err != nil {
+			return fmt.Errorf("can't convert the balance of '%s': %w", wallet.Name, err)
+		}
+		tx := Transaction{Amount: balance, Kind: TransactionSet, PreviousCurrency: oldCurrency}
+		tx.Memo = fmt.Sprintf("Currency changed from %s, balance kept", oldCurrency)
+		if convert {
+			tx.Memo = fmt.Sprintf("Converted from %s at %g", oldCurrency, rate)
+			tx.Rate, tx.RateSource = rate, rateSource
+		}
+		if _, err := wallet.record(tx); err != nil {
+			return err
+		}
+		if wallet.CreditLimit != nil {
+			limit, err := wallet.CreditLimit.MulRate(rate, exp)
+			if err != nil {
+				return fmt.Errorf("can't convert the credit limit of '%s': %w", wallet.Name, err)
+			}
+			wallet.CreditLimit = &limit
+		}
+		for i := range wallet.Holdings {
+			holding := &wallet.Holdings[i]
+			if holding.CostBasis, err = holding.CostBasis.MulRate(rate, exp); err != nil {
+				return fmt.Errorf("can't convert %s in '%s': %w", holding.Symbol, wallet.Name, err)
+			}
+			if holding.Value, err = holding.Value.MulRate(rate, exp); err != nil {
+				return fmt.Errorf("can't convert %s in '%s': %w", holding.Symbol, wallet.Name, err)
+			}
+		}
+
+		// Converted wallets keep receiving what their rules meant in the old currency
+		if convert {
+			for i := range data.Recurring {
+				if data.Recurring[i].WalletID == id && data.Recurring[i].Currency == "" {
+					data.Recurring[i].Currency = oldCurrency
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.Save(data)
+}
+
+func DeleteWallet(s Store, data *BudgetFile, id string) error {
+	index, err := FindWallet(data, id)
+	if err != nil {
+		return err
+	}
+
+	err = data.journal(fmt.Sprintf("delete wallet '%s'", data.Wallets[index].Name), func() error {
+		data.Wallets = append(data.Wallets[:index], data.Wallets[index+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save(data)
 }
 
 // CreateExampleBudget creates a sample budget with example wallets for new users
-func CreateExampleBudget() error {
+func CreateExampleBudget(s Store) error {
 	// Create the example budget file
-	err := CreateBudgetFile("example")
+	data, err := s.Create("example")
 	if err != nil {
 		return fmt.Errorf("failed to create example budget file: %v", err)
 	}
 
 	// Add sample wallets
 	sampleWallets := []struct {
-		name, owner, walletType, currency string
-		balance                           float64
+		name, owner, walletType, currency, balance string
 	}{
-		{"Cash Wallet", "User", "cash", "USD", 250.75},
-		{"Bank Account", "User", "bank", "USD", 1500.00},
-		{"Savings Fund", "User", "bank", "EUR", 800.50},
-		{"Investment Portfolio", "User", "invest", "USD", 5000.00},
-		{"Emergency Fund", "Family", "bank", "USD", 2000.00},
+		{"Cash Wallet", "User", "cash", "USD", "250.75"},
+		{"Bank Account", "User", "bank", "USD", "1500.00"},
+		{"Savings Fund", "User", "bank", "EUR", "800.50"},
+		{"Investment Portfolio", "User", "invest", "USD", "5000.00"},
+		{"Emergency Fund", "Family", "bank", "USD", "2000.00"},
 	}
 
 	for _, wallet := range sampleWallets {
-		err := CreateWallet("example", wallet.name, wallet.owner, wallet.walletType, wallet.currency, wallet.balance)
+		balance, err := ParseMoney(wallet.balance, CurrencyExponent(wallet.currency))
+		if err != nil {
+			return fmt.Errorf("invalid balance for sample wallet '%s': %v", wallet.name, err)
+		}
+
+		err = CreateWallet(s, data, wallet.name, wallet.owner, wallet.walletType, wallet.currency, balance)
 		if err != nil {
 			return fmt.Errorf("failed to create sample wallet '%s': %v", wallet.name, err)
 		}
@@ -1,18 +1,46 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 
+	"github.com/kkrll/the-terminal-budget/data"
 	"github.com/kkrll/the-terminal-budget/tui"
 )
 
 func main() {
-	runTUI()
+	dataDir := flag.String("data-dir", "", "directory to keep budget files in, e.g. a shared team folder (overrides BUDGET_HOME and XDG_DATA_HOME)")
+	offline := flag.Bool("offline", false, "never fetch exchange rates; convert with the last cached ones however old")
+	flag.Parse()
+
+	paths, err := data.Configure(*dataDir)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *offline {
+		data.SetOffline(true)
+	}
+
+	// Keep background messages such as schema migrations out of the terminal UI
+	if logFile, err := data.OpenLogFile(); err == nil {
+		log.SetOutput(logFile)
+		defer logFile.Close()
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	if notice := data.MigrateLegacyHome(); notice != "" {
+		fmt.Println(notice)
+	}
+
+	runTUI(data.NewDirStore(paths.DataDir))
 }
 
-func runTUI() {
-	if err := tui.RunTUI(); err != nil {
+func runTUI(store data.Store) {
+	if err := tui.RunTUI(store); err != nil {
 		fmt.Println("Error running TUI:", err)
 		os.Exit(1)
 	}
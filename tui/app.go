@@ -14,6 +14,8 @@ const (
 	walletScreen
 	walletCreationScreen
 	confirmationScreen
+	passphraseScreen
+	forecastScreen
 )
 
 // Use the shared Wallet type from data package
@@ -23,6 +25,8 @@ type model struct {
 	currentScreen   screen
 	greeting        string
 	currentPath     string
+	store           data.Store
+	budget          *data.BudgetFile
 	wallets         []Wallet
 	err             error
 	width           int
@@ -30,23 +34,30 @@ type model struct {
 	commandInput    string
 	commandResult   string
 	cursorPos       int
-	hiddenIndexes   map[int]bool
+	hiddenWallets   map[string]bool // keyed by wallet ID
 	filterOwner     string
 	filterType      string
 	filterCurrency  string
 	displayCurrency string
+	showSymbols     bool // "$12.50" instead of "12.50 USD"
+	totals          walletTotals
+
+	// Advisory lock on the open budget; nil when opened read-only
+	budgetLock *data.BudgetLock
+	readOnly   bool
 
 	// File selection state
 	availableFiles    []data.BudgetFile
 	selectedFileIndex int
 	isNewFile         bool
+	creationError     string // why the typed budget name or currency was rejected
 
 	// Wallet creation state
 	creationStep      int
 	creationData      Wallet
 	creationInput     string
 	creationCursorPos int
-	creationPrefilled bool
+	creationPrefilled bool // editing creationData.ID: each step starts with its current value
 
 	// Selection state for option-based steps
 	creationOptions []string
@@ -57,7 +68,20 @@ type model struct {
 	confirmationMessage string
 	confirmationAction  func() error
 	onConfirm           func(*model) (tea.Model, tea.Cmd)
+	onCancel            func(*model) (tea.Model, tea.Cmd)
 	originScreen        screen
+
+	// Forecast view state
+	forecast       *data.Forecast
+	forecastOffset int // first row shown
+
+	// Passphrase prompt state
+	passphrasePrompt string
+	passphraseInput  string
+	passphraseFirst  string // first entry while a new passphrase is typed again
+	passphraseRepeat bool   // ask twice, for choosing a new passphrase
+	passphraseError  string
+	passphraseAction func(m *model, passphrase string) error
 }
 
 func (m model) Init() tea.Cmd {
@@ -84,6 +108,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return (&m).handleBudgetCreationInput(msg)
 		case confirmationScreen:
 			return (&m).handleConfirmationInput(msg)
+		case passphraseScreen:
+			return (&m).handlePassphraseInput(msg)
+		case forecastScreen:
+			return (&m).handleForecastInput(msg)
 		case walletScreen:
 			return (&m).handleWalletInput(msg)
 		case walletCreationScreen:
@@ -99,6 +127,10 @@ func (m model) View() string {
 		return m.GreetingView()
 	case confirmationScreen:
 		return m.ConfirmationView()
+	case passphraseScreen:
+		return m.PassphraseView()
+	case forecastScreen:
+		return m.forecastView()
 	case budgetCreationScreen:
 		return m.BudgetCreationView()
 	case walletScreen:
@@ -109,37 +141,47 @@ func (m model) View() string {
 	return ""
 }
 
-func RunTUI() error {
+func RunTUI(store data.Store) error {
 	// Load available budget files
-	availableFiles, err := data.ListBudgetFiles()
+	availableFiles, err := store.List()
 	if err != nil {
 		availableFiles = []data.BudgetFile{} // Start with empty list if error
 	}
 
 	// Auto-create example budget if no files exist (first-time user experience)
 	if len(availableFiles) == 0 {
-		err := data.CreateExampleBudget()
+		err := data.CreateExampleBudget(store)
 		if err != nil {
 			// If example creation fails, continue anyway - user can create manually
 			// This ensures the app doesn't crash on first run
 		} else {
 			// Reload files to include the new example budget
-			availableFiles, _ = data.ListBudgetFiles()
+			availableFiles, _ = store.List()
 		}
 	}
 
 	initialModel := model{
 		currentScreen:     greetingScreen,
 		greeting:          getRandomGreeting(),
+		store:             store,
 		width:             80,
 		height:            24,
-		hiddenIndexes:     make(map[int]bool),
+		hiddenWallets:     make(map[string]bool),
 		availableFiles:    availableFiles,
 		selectedFileIndex: 0,
 		isNewFile:         false,
 	}
 
 	p := tea.NewProgram(initialModel, tea.WithAltScreen())
-	_, err = p.Run()
+	finalModel, err := p.Run()
+
+	// Release the lock on whatever budget was open when the app quit
+	switch final := finalModel.(type) {
+	case model:
+		final.closeBudget()
+	case *model:
+		final.closeBudget()
+	}
+
 	return err
 }
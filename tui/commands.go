@@ -2,14 +2,51 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kkrll/the-terminal-budget/data"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// Commands that change the budget file and are refused in read-only mode
+var mutatingCommands = map[string]bool{
+	"new":       true,
+	"adjust":    true,
+	"transfer":  true,
+	"delete":    true,
+	"edit":      true,
+	"limit":     true,
+	"holding":   true,
+	"price":     true,
+	"encrypt":   true,
+	"decrypt":   true,
+	"undo":      true,
+	"redo":      true,
+	"rate":      true,
+	"recurring": true,
+}
+
+// Of the mutating commands, these only list what is set when called bare or
+// with "list"
+var listingCommands = map[string]bool{
+	"rate":      true,
+	"recurring": true,
+}
+
+// mutates reports whether a command line would change the budget file
+func mutates(parts []string) bool {
+	if listingCommands[parts[0]] && (len(parts) == 1 || parts[1] == "list") {
+		return false
+	}
+	return mutatingCommands[parts[0]]
+}
+
+const readOnlyMessage = "This budget is open in another window, so it is read-only here."
+
 func (m *model) HandleCommand(cmd string) string {
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
@@ -18,9 +55,13 @@ func (m *model) HandleCommand(cmd string) string {
 		return "Display refreshed"
 	}
 
+	if m.readOnly && mutates(parts) {
+		return readOnlyMessage
+	}
+
 	switch parts[0] {
 	case "help":
-		return "Available commands:\nadjust 0 +100 | delete 1 | hide 0,2\nnew | filter owner alice | currency USD"
+		return "Available commands:\nadjust 0 +100 rent | transfer 1 2 100 | delete 1 | hide 0,2\nnew | edit 1 | limit 3 5000 | holding 2 VWCE 10 950 | holdings 2 | price VWCE 112.30\nfilter owner alice | currency USD | display symbols | offline on | rate USD ARS 1050 | units | history week | value-at 2024-12-31\nrecurring | forecast 90 | undo | redo 2 | encrypt | decrypt"
 
 	case "filter":
 		if len(parts) < 2 {
@@ -30,7 +71,7 @@ func (m *model) HandleCommand(cmd string) string {
 			m.filterOwner = ""
 			m.filterType = ""
 			m.filterCurrency = ""
-			m.hiddenIndexes = make(map[int]bool)
+			m.hiddenWallets = make(map[string]bool)
 			return "Filters cleared"
 		}
 		if len(parts) < 3 {
@@ -66,14 +107,38 @@ func (m *model) HandleCommand(cmd string) string {
 		}
 		return m.handleCurrencyCommand(parts[1])
 
+	case "display":
+		if len(parts) < 2 {
+			return "Usage: display symbols | display codes"
+		}
+		return m.handleDisplayCommand(parts[1])
+
+	case "offline":
+		if len(parts) < 2 {
+			return "Usage: offline on | offline off"
+		}
+		return m.handleOfflineCommand(parts[1])
+
 	case "new":
 		return m.handleNewWalletCommand()
 
+	case "edit":
+		if len(parts) < 2 {
+			return "Usage: edit <index>"
+		}
+		return m.handleEditWalletCommand(parts[1])
+
 	case "adjust":
 		if len(parts) < 3 {
-			return "Usage: adjust <index> <amount> (e.g., adjust 0 +100, adjust 1 -50, adjust 2 500)"
+			return "Usage: adjust <index> <amount> [memo] (e.g., adjust 0 +100 salary, adjust 1 -50, adjust 2 500)"
+		}
+		return m.handleAdjustCommand(parts[1], parts[2], strings.Join(parts[3:], " "))
+
+	case "transfer":
+		if len(parts) < 4 {
+			return "Usage: transfer <from> <to> <amount> [fee] [@rate] (e.g., transfer 1 2 100, transfer 1 2 100 2.50 @0.92)"
 		}
-		return m.handleAdjustCommand(parts[1], parts[2])
+		return m.handleTransferCommand(parts[1], parts[2], parts[3], parts[4:])
 
 	case "delete":
 		if len(parts) < 2 {
@@ -81,6 +146,80 @@ func (m *model) HandleCommand(cmd string) string {
 		}
 		return m.handleDeleteCommand(parts[1])
 
+	case "limit":
+		if len(parts) < 3 {
+			return "Usage: limit <index> <amount> (e.g., limit 3 5000; 0 removes the limit)"
+		}
+		return m.handleLimitCommand(parts[1], parts[2])
+
+	case "holding":
+		if len(parts) < 4 {
+			return "Usage: holding <index> <symbol> <quantity> [cost basis] (e.g., holding 2 VWCE 10 950; quantity 0 removes it)"
+		}
+		return m.handleHoldingCommand(parts[1], parts[2], parts[3], parts[4:])
+
+	case "holdings":
+		if len(parts) < 2 {
+			return "Usage: holdings <index>"
+		}
+		return m.handleHoldingsCommand(parts[1])
+
+	case "price":
+		if len(parts) < 3 {
+			return "Usage: price <symbol> <value> [currency] (e.g., price VWCE 112.30 EUR)"
+		}
+		return m.handlePriceCommand(parts[1], parts[2], parts[3:])
+
+	case "units":
+		return m.handleUnitsCommand(parts[1:])
+
+	case "rate":
+		return m.handleRateCommand(parts[1:])
+
+	case "history":
+		period := "day"
+		if len(parts) > 1 {
+			period = parts[1]
+		}
+		return m.handleHistoryCommand(period)
+
+	case "value-at":
+		if len(parts) < 2 {
+			return "Usage: value-at <YYYY-MM-DD> (e.g., value-at 2024-12-31)"
+		}
+		return m.handleValueAtCommand(parts[1])
+
+	case "recurring":
+		return m.handleRecurringCommand(parts[1:])
+
+	case "forecast":
+		days := 30
+		if len(parts) > 1 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return "Usage: forecast <days> (e.g., forecast 90)"
+			}
+			days = n
+		}
+		return m.handleForecastCommand(days)
+
+	case "undo", "redo":
+		steps := 1
+		if len(parts) > 1 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n < 1 {
+				return fmt.Sprintf("Usage: %s [steps]", parts[0])
+			}
+			steps = n
+		}
+		return m.handleUndoCommand(parts[0] == "redo", steps)
+
+	case "encrypt":
+		return m.handleEncryptCommand()
+
+	case "decrypt":
+		return m.handleDecryptCommand()
+
 	default:
 		return fmt.Sprintf("Unknown command: %s. Type 'help' for available commands.", parts[0])
 	}
@@ -91,15 +230,11 @@ func (m *model) handleHideCommand(indexStr string) string {
 	var hiddenCount int
 
 	for _, idxStr := range indexes {
-		idxStr = strings.TrimSpace(idxStr)
-		idx, err := strconv.Atoi(idxStr)
-		if err != nil {
-			return fmt.Sprintf("Invalid index: %s", idxStr)
-		}
-		if idx < 0 || idx >= len(m.wallets) {
-			return fmt.Sprintf("Index %d is out of range (0-%d)", idx, len(m.wallets)-1)
+		wallet, errMsg := m.walletAt(strings.TrimSpace(idxStr))
+		if errMsg != "" {
+			return errMsg
 		}
-		m.hiddenIndexes[idx] = true
+		m.hiddenWallets[wallet.ID] = true
 		hiddenCount++
 	}
 
@@ -107,9 +242,38 @@ func (m *model) handleHideCommand(indexStr string) string {
 }
 
 func (m *model) handleCurrencyCommand(currency string) string {
-	currency = strings.ToUpper(currency)
-	m.displayCurrency = currency
-	return fmt.Sprintf("Display currency changed to %s", currency)
+	unit, err := data.LookupUnit(currency)
+	if err != nil {
+		return err.Error()
+	}
+	m.displayCurrency = unit.Code
+	return fmt.Sprintf("Display currency changed to %s", unit.Code)
+}
+
+func (m *model) handleDisplayCommand(mode string) string {
+	switch mode {
+	case "symbols", "symbol":
+		m.showSymbols = true
+		return "Showing amounts with currency symbols, like $12.50"
+	case "codes", "code":
+		m.showSymbols = false
+		return "Showing amounts with currency codes, like 12.50 USD"
+	default:
+		return "Usage: display symbols | display codes"
+	}
+}
+
+func (m *model) handleOfflineCommand(mode string) string {
+	switch mode {
+	case "on":
+		data.SetOffline(true)
+		return "Offline: converting with the last cached exchange rates"
+	case "off":
+		data.SetOffline(false)
+		return "Online: exchange rates are fetched when the cached ones are out of date"
+	default:
+		return "Usage: offline on | offline off"
+	}
 }
 
 func (m *model) handleNewWalletCommand() string {
@@ -128,40 +292,58 @@ func (m *model) handleNewWalletCommand() string {
 	return ""
 }
 
-func (m *model) handleAdjustCommand(indexStr, amountStr string) string {
+// handleEditWalletCommand reopens the wallet wizard with the wallet's values
+func (m *model) handleEditWalletCommand(indexStr string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	m.handleNewWalletCommand()
+	m.creationData = wallet
+	m.creationPrefilled = true
+	m.prefillCreationStep()
+
+	return ""
+}
+
+// walletAt resolves an index typed by the user to the wallet shown at that
+// position. On failure it returns a message to show instead.
+func (m *model) walletAt(indexStr string) (Wallet, string) {
 	idx, err := strconv.Atoi(indexStr)
 	if err != nil {
-		return fmt.Sprintf("Invalid index: %s", indexStr)
+		return Wallet{}, fmt.Sprintf("Invalid index: %s", indexStr)
 	}
 
 	if idx < 0 || idx >= len(m.wallets) {
-		return fmt.Sprintf("Index %d is out of range (0-%d)", idx, len(m.wallets)-1)
+		return Wallet{}, fmt.Sprintf("Index %d is out of range (0-%d)", idx, len(m.wallets)-1)
 	}
 
-	var amount float64
-	var isSet bool
+	return m.wallets[idx], ""
+}
 
-	if strings.HasPrefix(amountStr, "+") || strings.HasPrefix(amountStr, "-") {
-		amount, err = strconv.ParseFloat(amountStr, 64)
-		isSet = false
-	} else {
-		amount, err = strconv.ParseFloat(amountStr, 64)
-		isSet = true
+func (m *model) handleAdjustCommand(indexStr, amountStr, memo string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
 	}
 
+	isSet := !strings.HasPrefix(amountStr, "+") && !strings.HasPrefix(amountStr, "-")
+
+	amount, err := data.ParseAmount(amountStr, wallet.Currency)
 	if err != nil {
-		return fmt.Sprintf("Invalid amount: %s", amountStr)
+		return fmt.Sprintf("Invalid amount: %v", err)
 	}
 
 	var dataErr error
 	if isSet {
-		dataErr = data.SetWalletBalanceByIndex(m.currentPath, idx, amount)
+		dataErr = data.SetWalletBalance(m.store, m.budget, wallet.ID, amount, memo)
 	} else {
-		dataErr = data.AdjustWalletByIndex(m.currentPath, idx, amount)
+		dataErr = data.AdjustWallet(m.store, m.budget, wallet.ID, amount, memo)
 	}
 
 	if dataErr != nil {
-		return fmt.Sprintf("Failed to adjust wallet: %v", dataErr)
+		return m.handleSaveError(dataErr, "adjust wallet")
 	}
 
 	m.wallets, m.err = m.loadWallets()
@@ -169,42 +351,223 @@ func (m *model) handleAdjustCommand(indexStr, amountStr string) string {
 		return fmt.Sprintf("Wallet adjusted, but failed to reload: %v", m.err)
 	}
 
-	walletName := m.wallets[idx].Name
+	walletName := wallet.Name
 	if isSet {
-		return fmt.Sprintf("Set %s balance to %.2f", walletName, amount)
+		return fmt.Sprintf("Set %s balance to %s", walletName, m.formatAmount(amount, wallet.Currency))
 	} else {
-		return fmt.Sprintf("Adjusted %s by %.2f", walletName, amount)
+		return fmt.Sprintf("Adjusted %s by %s", walletName, m.formatSigned(amount, wallet.Currency))
 	}
 }
 
-func (m *model) handleDeleteCommand(indexStr string) string {
-	idx, err := strconv.Atoi(indexStr)
+func (m *model) handleTransferCommand(fromStr, toStr, amountStr string, extra []string) string {
+	from, errMsg := m.walletAt(fromStr)
+	if errMsg != "" {
+		return errMsg
+	}
+	to, errMsg := m.walletAt(toStr)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	amount, err := data.ParseAmount(amountStr, from.Currency)
 	if err != nil {
-		return fmt.Sprintf("Invalid index: %s", indexStr)
+		return fmt.Sprintf("Invalid amount: %v", err)
 	}
 
-	if idx < 0 || idx >= len(m.wallets) {
-		return fmt.Sprintf("Index %d is out of range (0-%d)", idx, len(m.wallets)-1)
+	// The optional fee is in the source currency; a rate is written as @<rate>
+	fee := data.NewMoney(0, data.CurrencyExponent(from.Currency))
+	var rate float64
+	for _, arg := range extra {
+		if rateStr, ok := strings.CutPrefix(arg, "@"); ok {
+			rate, err = strconv.ParseFloat(rateStr, 64)
+			if err != nil || rate <= 0 {
+				return fmt.Sprintf("Invalid rate: %s", rateStr)
+			}
+			continue
+		}
+		fee, err = data.ParseAmount(arg, from.Currency)
+		if err != nil {
+			return fmt.Sprintf("Invalid fee: %v", err)
+		}
+	}
+
+	credit, err := data.TransferFunds(m.store, m.budget, from.ID, to.ID, amount, fee, rate)
+	if err != nil {
+		return m.handleSaveError(err, "transfer")
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("Transferred, but failed to reload: %v", m.err)
+	}
+
+	result := fmt.Sprintf("Moved %s from %s to %s", m.formatAmount(amount, from.Currency), from.Name, to.Name)
+	if from.Currency != to.Currency {
+		result += fmt.Sprintf(" (%s at %g)", m.formatAmount(credit.Amount, to.Currency), credit.Rate)
+	}
+	if !fee.IsZero() {
+		result += fmt.Sprintf(", fee %s", m.formatAmount(fee, from.Currency))
+	}
+	return result
+}
+
+func (m *model) handleLimitCommand(indexStr, amountStr string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	limit, err := data.ParseAmount(amountStr, wallet.Currency)
+	if err != nil {
+		return fmt.Sprintf("Invalid amount: %v", err)
+	}
+
+	if err := data.SetCreditLimit(m.store, m.budget, wallet.ID, limit); err != nil {
+		return m.handleSaveError(err, "set credit limit")
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("Credit limit set, but failed to reload: %v", m.err)
+	}
+
+	if limit.IsZero() {
+		return fmt.Sprintf("Removed the credit limit of %s", wallet.Name)
+	}
+	return fmt.Sprintf("Credit limit of %s set to %s", wallet.Name, m.formatAmount(limit, wallet.Currency))
+}
+
+func (m *model) handleHoldingCommand(indexStr, symbol, quantityStr string, extra []string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	quantity, err := data.ParseQuantity(quantityStr)
+	if err != nil {
+		return fmt.Sprintf("Invalid quantity: %s", quantityStr)
+	}
+
+	var costBasis *data.Money
+	if len(extra) > 0 {
+		cost, err := data.ParseAmount(extra[0], wallet.Currency)
+		if err != nil {
+			return fmt.Sprintf("Invalid cost basis: %v", err)
+		}
+		costBasis = &cost
+	}
+
+	prices := data.DefaultPrices(m.budget)
+	if err := data.SetHolding(m.store, m.budget, wallet.ID, symbol, quantity, costBasis, prices); err != nil {
+		return m.handleSaveError(err, "update holding")
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("Holding updated, but failed to reload: %v", m.err)
+	}
+
+	symbol = strings.ToUpper(symbol)
+	if quantity.IsZero() {
+		return fmt.Sprintf("Removed %s from %s", symbol, wallet.Name)
+	}
+	if _, err := prices.Price(symbol); err != nil {
+		return fmt.Sprintf("%s now holds %s %s, but it has no price yet; set one with 'price %s <value>'", wallet.Name, quantity, symbol, symbol)
+	}
+	return fmt.Sprintf("%s now holds %s %s", wallet.Name, quantity, symbol)
+}
+
+func (m *model) handleHoldingsCommand(indexStr string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
+	}
+	if len(wallet.Holdings) == 0 {
+		return fmt.Sprintf("%s has no holdings. Add one with 'holding %s <symbol> <quantity> [cost basis]'", wallet.Name, indexStr)
+	}
+
+	prices := data.DefaultPrices(m.budget)
+	lines := []string{fmt.Sprintf("%s holdings in %s:", wallet.Name, wallet.Currency)}
+	for _, holding := range wallet.Holdings {
+		priced := "no price"
+		if price, err := prices.Price(holding.Symbol); err == nil {
+			currency := price.Currency
+			if currency == "" {
+				currency = wallet.Currency
+			}
+			priced = "@ " + m.formatAmount(price.Value, currency)
+		}
+		gain := "out of range"
+		if amount, err := holding.Gain(); err == nil {
+			gain = m.formatBalance(amount, wallet.Currency)
+		}
+		lines = append(lines, fmt.Sprintf("%-8s %12s %-18s %12s %12s",
+			truncate(holding.Symbol, 8), holding.Quantity, priced,
+			m.formatBalance(holding.Value, wallet.Currency), gain))
+	}
+
+	value, cost, err := wallet.HoldingsTotals()
+	if err != nil {
+		return fmt.Sprintf("Can't total the holdings of %s: %v", wallet.Name, err)
+	}
+	gain, err := value.Sub(cost)
+	if err != nil {
+		return fmt.Sprintf("Can't total the holdings of %s: %v", wallet.Name, err)
+	}
+	lines = append(lines, fmt.Sprintf("Value %s, cost %s, unrealized gain %s",
+		m.formatAmount(value, wallet.Currency), m.formatAmount(cost, wallet.Currency), m.formatSigned(gain, wallet.Currency)))
+	if cash, err := wallet.Balance.Sub(value); err == nil && !cash.IsZero() {
+		lines = append(lines, fmt.Sprintf("Cash %s", m.formatAmount(cash, wallet.Currency)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) handlePriceCommand(symbol, valueStr string, extra []string) string {
+	value, err := data.ParseQuantity(valueStr)
+	if err != nil {
+		return fmt.Sprintf("Invalid price: %s", valueStr)
+	}
+
+	currency := ""
+	if len(extra) > 0 {
+		currency = extra[0]
+	}
+
+	if err := data.SetPrice(m.store, m.budget, symbol, value, currency, data.DefaultPrices(m.budget)); err != nil {
+		return m.handleSaveError(err, "set price")
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("Price set, but failed to reload: %v", m.err)
+	}
+
+	priced := fmt.Sprintf("%s %s", value, strings.ToUpper(currency))
+	return fmt.Sprintf("Priced %s at %s and revalued holdings", strings.ToUpper(symbol), strings.TrimSpace(priced))
+}
+
+func (m *model) handleDeleteCommand(indexStr string) string {
+	wallet, errMsg := m.walletAt(indexStr)
+	if errMsg != "" {
+		return errMsg
 	}
 
-	walletName := m.wallets[idx].Name
-	walletOwner := m.wallets[idx].Owner
+	walletName := wallet.Name
+	walletOwner := wallet.Owner
 
 	// Set up confirmation dialog instead of immediate deletion
 	m.confirmationMessage = fmt.Sprintf("Are you sure you want to delete wallet '%s' (owned by %s)?", walletName, walletOwner)
 	m.originScreen = walletScreen
 	m.confirmationAction = func() error {
-		return data.DeleteWalletByIndex(m.currentPath, idx)
+		return data.DeleteWallet(m.store, m.budget, wallet.ID)
 	}
 	m.onConfirm = func(m *model) (tea.Model, tea.Cmd) {
-		// After successful deletion, reload wallets and clear hidden indexes
+		// After successful deletion, reload wallets; hidden wallets are tracked by ID
 		m.wallets, m.err = m.loadWallets()
 		if m.err != nil {
 			m.err = fmt.Errorf("wallet deleted, but failed to reload: %v", m.err)
 		}
-
-		// Clear hidden indexes since wallet positions have changed
-		m.hiddenIndexes = make(map[int]bool)
+		delete(m.hiddenWallets, wallet.ID)
 
 		return m, nil
 	}
@@ -212,3 +575,444 @@ func (m *model) handleDeleteCommand(indexStr string) string {
 
 	return "" // Return empty string since we're switching to confirmation screen
 }
+
+func (m *model) handleUndoCommand(redo bool, steps int) string {
+	next, step, action, verb := data.NextUndo, data.Undo, "undo", "Undid"
+	if redo {
+		next, step, action, verb = data.NextRedo, data.Redo, "redo", "Redid"
+	}
+
+	if _, ok := next(m.budget); !ok {
+		return fmt.Sprintf("Nothing to %s", action)
+	}
+
+	var done []string
+	for range steps {
+		if _, ok := next(m.budget); !ok {
+			break
+		}
+		entry, err := step(m.store, m.budget)
+		if err != nil {
+			return m.handleSaveError(err, action)
+		}
+		done = append(done, entry.Description)
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("%s, but failed to reload: %v", verb, m.err)
+	}
+
+	return fmt.Sprintf("%s: %s", verb, strings.Join(done, "; "))
+}
+
+// historyRows is how many periods the history command shows
+const historyRows = 12
+
+func (m *model) handleHistoryCommand(period string) string {
+	history, err := data.NetWorthHistory(m.budget, period)
+	if err != nil {
+		return fmt.Sprintf("Usage: history [day|week|month] (%v)", err)
+	}
+	if len(history) == 0 {
+		return "No history yet. A snapshot is taken every day the budget is saved."
+	}
+
+	if len(history) > historyRows {
+		history = history[len(history)-historyRows:]
+	}
+
+	lines := []string{fmt.Sprintf("Net worth by %s:", period)}
+	partial := false
+	for _, entry := range history {
+		total := m.formatAmount(entry.Snapshot.Total, entry.Snapshot.Currency)
+		if !entry.Snapshot.Complete() {
+			total += "*"
+			partial = true
+		}
+
+		delta := ""
+		if entry.HasDelta {
+			delta = m.formatSigned(entry.Delta, entry.Snapshot.Currency)
+		}
+
+		lines = append(lines, fmt.Sprintf("%-10s %20s %14s", entry.Period, total, delta))
+	}
+	if partial {
+		lines = append(lines, "* some wallets couldn't be converted and are left out")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) handleValueAtCommand(dateStr string) string {
+	day, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+	if err != nil {
+		return "Usage: value-at <YYYY-MM-DD> (e.g., value-at 2024-12-31)"
+	}
+
+	snapshot, err := data.ValueAt(m.budget, day, m.displayCurrency)
+	if err != nil {
+		return fmt.Sprintf("Can't value the budget: %v", err)
+	}
+	if len(snapshot.Balances) == 0 {
+		return fmt.Sprintf("No wallets existed yet on %s", dateStr)
+	}
+
+	lines := []string{fmt.Sprintf("Budget at the end of %s, at that day's rates:", dateStr)}
+	for _, balance := range snapshot.Balances {
+		name := balance.Name
+		if slices.Contains(snapshot.Unconverted, balance.WalletID) {
+			name += "*"
+		}
+		lines = append(lines, fmt.Sprintf("%-15s %20s", truncate(name, 15), m.formatAmount(balance.Balance, balance.Currency)))
+	}
+	lines = append(lines, fmt.Sprintf("%-15s %20s", "Net worth", m.formatAmount(snapshot.Total, snapshot.Currency)))
+	if !snapshot.Complete() {
+		lines = append(lines, fmt.Sprintf("* no %s rate for that day, left out of the net worth", snapshot.Currency))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) handleEncryptCommand() string {
+	prompt := fmt.Sprintf("Choose a passphrase for '%s'", m.budget.Name)
+	result := "Budget encrypted. You'll need the passphrase to open it next time."
+	if m.budget.Encrypted {
+		prompt = fmt.Sprintf("Choose a new passphrase for '%s'", m.budget.Name)
+		result = "Passphrase changed"
+	}
+
+	m.promptPassphrase(prompt, true, func(m *model, passphrase string) error {
+		err := data.EncryptBudget(m.store, m.budget, passphrase)
+		CleanSlates(m)
+		m.currentScreen = walletScreen
+		if err != nil {
+			m.commandResult = m.handleSaveError(err, "encrypt budget")
+			return nil
+		}
+
+		m.wallets, m.err = m.loadWallets()
+		m.commandResult = result
+		return nil
+	})
+
+	return ""
+}
+
+func (m *model) handleDecryptCommand() string {
+	if !m.budget.Encrypted {
+		return "This budget isn't encrypted"
+	}
+
+	m.confirmationMessage = fmt.Sprintf("Store budget '%s' without encryption? Anyone who can read the file will see your balances.", m.budget.Name)
+	m.originScreen = walletScreen
+	m.confirmationAction = func() error {
+		return data.DecryptBudget(m.store, m.budget)
+	}
+	m.onConfirm = func(m *model) (tea.Model, tea.Cmd) {
+		m.wallets, m.err = m.loadWallets()
+		m.commandResult = "Budget decrypted"
+		return m, nil
+	}
+	m.currentScreen = confirmationScreen
+
+	return ""
+}
+
+const unitsUsage = "Usage: units | units add <CODE> <decimals> [<rate> <currency>] [name] | units remove <CODE>\n" +
+	"e.g., units add MILES 0 0.012 USD Air miles. Without a rate, the unit is priced from the price file."
+
+func (m *model) handleUnitsCommand(args []string) string {
+	if len(args) == 0 || args[0] == "list" {
+		lines := []string{"Units besides the ISO 4217 currencies:"}
+		for _, unit := range data.ListUnits() {
+			line := fmt.Sprintf("%-6s %-24s %-9s %d decimals", unit.Code, truncate(unit.Name, 24), unit.Kind, unit.Precision)
+			if unit.Rate > 0 {
+				line += fmt.Sprintf(", 1 = %g %s", unit.Rate, unit.RateCurrency)
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			return unitsUsage
+		}
+		precision, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Sprintf("Invalid number of decimals: %s", args[2])
+		}
+
+		var rate float64
+		var rateCurrency string
+		rest := args[3:]
+		if len(rest) >= 2 {
+			if r, err := strconv.ParseFloat(rest[0], 64); err == nil {
+				rate, rateCurrency, rest = r, rest[1], rest[2:]
+			}
+		}
+
+		unit, err := data.AddCustomUnit(args[1], strings.Join(rest, " "), precision, rate, rateCurrency)
+		if err != nil {
+			return fmt.Sprintf("Failed to add unit: %v", err)
+		}
+		if unit.Rate > 0 {
+			return fmt.Sprintf("Added %s (%s), 1 %s = %g %s", unit.Code, unit.Name, unit.Code, unit.Rate, unit.RateCurrency)
+		}
+		return fmt.Sprintf("Added %s (%s); it enters totals once the price file has a price for it", unit.Code, unit.Name)
+
+	case "remove":
+		if len(args) < 2 {
+			return unitsUsage
+		}
+		if err := data.RemoveCustomUnit(args[1]); err != nil {
+			return fmt.Sprintf("Failed to remove unit: %v", err)
+		}
+		m.wallets, m.err = m.loadWallets()
+		return fmt.Sprintf("Removed %s", strings.ToUpper(args[1]))
+
+	default:
+		return unitsUsage
+	}
+}
+
+const rateUsage = "Usage: rate | rate <FROM> <TO> <rate> (e.g., rate USD ARS 1050) | rate clear [<FROM> <TO>]"
+
+func (m *model) handleRateCommand(args []string) string {
+	if len(args) == 0 || args[0] == "list" {
+		return m.listRateOverrides()
+	}
+
+	prices := data.DefaultPrices(m.budget)
+	if args[0] == "clear" {
+		from, to := "", ""
+		switch len(args) {
+		case 1:
+		case 3:
+			from, to = args[1], args[2]
+		default:
+			return rateUsage
+		}
+		if err := data.ClearRateOverride(m.store, m.budget, from, to, prices); err != nil {
+			return m.handleSaveError(err, "clear rate")
+		}
+		m.wallets, m.err = m.loadWallets()
+		if from == "" {
+			return "Cleared all rate overrides; conversions use market rates again"
+		}
+		return fmt.Sprintf("Cleared the %s/%s rate; it uses the market rate again", strings.ToUpper(from), strings.ToUpper(to))
+	}
+
+	if len(args) != 3 {
+		return rateUsage
+	}
+	rate, err := strconv.ParseFloat(strings.ReplaceAll(args[2], ",", ""), 64)
+	if err != nil {
+		return fmt.Sprintf("Invalid rate: %s", args[2])
+	}
+	if err := data.SetRateOverride(m.store, m.budget, args[0], args[1], rate, prices); err != nil {
+		return m.handleSaveError(err, "set rate")
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	if m.err != nil {
+		return fmt.Sprintf("Rate set, but failed to reload: %v", m.err)
+	}
+	return fmt.Sprintf("1 %s = %g %s in this budget", strings.ToUpper(args[0]), rate, strings.ToUpper(args[1]))
+}
+
+func (m *model) listRateOverrides() string {
+	if len(m.budget.RateOverrides) == 0 {
+		return "No rate overrides; conversions use market rates. Set one with 'rate USD ARS 1050'."
+	}
+
+	lines := []string{"Rate overrides (used both ways, before market rates):"}
+	for _, override := range m.budget.RateOverrides.Sorted() {
+		lines = append(lines, fmt.Sprintf("1 %s = %g %s   set %s",
+			override.From, override.Rate, override.To, formatTimeAgo(override.SetAt)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+const recurringUsage = "Usage: recurring | recurring add|expect <wallet> <amount> [currency] <cadence> [from:YYYY-MM-DD] [until:YYYY-MM-DD] [memo]\n" +
+	"recurring pause <n> | recurring resume <n> | recurring delete <n>\n" +
+	"Cadence: daily, weekly, monthly, yearly, or an nth weekday like 2nd-fri or last-mon. Expected items are only forecast, never posted."
+
+func (m *model) handleRecurringCommand(args []string) string {
+	if len(args) == 0 || args[0] == "list" {
+		return m.listRecurringRules()
+	}
+
+	switch args[0] {
+	case "add", "expect":
+		if len(args) < 4 {
+			return recurringUsage
+		}
+		return m.handleAddRecurringCommand(args[0] == "expect", args[1], args[2], args[3:])
+	case "pause", "resume", "delete":
+		if len(args) < 2 {
+			return recurringUsage
+		}
+		rule, errMsg := m.ruleAt(args[1])
+		if errMsg != "" {
+			return errMsg
+		}
+		if args[0] == "delete" {
+			return m.handleDeleteRecurringCommand(rule)
+		}
+
+		paused := args[0] == "pause"
+		if err := data.SetRecurringPaused(m.store, m.budget, rule.ID, paused); err != nil {
+			return m.handleSaveError(err, args[0]+" recurring rule")
+		}
+		if paused {
+			return fmt.Sprintf("Paused rule %s", args[1])
+		}
+		return fmt.Sprintf("Resumed rule %s; occurrences missed while paused are skipped", args[1])
+	default:
+		return recurringUsage
+	}
+}
+
+// ruleAt resolves a rule index typed by the user, like walletAt
+func (m *model) ruleAt(indexStr string) (data.RecurringRule, string) {
+	idx, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return data.RecurringRule{}, fmt.Sprintf("Invalid index: %s", indexStr)
+	}
+	if idx < 0 || idx >= len(m.budget.Recurring) {
+		return data.RecurringRule{}, fmt.Sprintf("Rule %d doesn't exist, see 'recurring' for the list", idx)
+	}
+	return m.budget.Recurring[idx], ""
+}
+
+// ruleCurrency returns the currency a rule's amount is in
+func (m *model) ruleCurrency(rule data.RecurringRule) string {
+	if rule.Currency != "" {
+		return rule.Currency
+	}
+	if index, err := data.FindWallet(m.budget, rule.WalletID); err == nil {
+		return m.budget.Wallets[index].Currency
+	}
+	return ""
+}
+
+func (m *model) listRecurringRules() string {
+	if len(m.budget.Recurring) == 0 {
+		return "No recurring rules yet. Add one with 'recurring add <wallet> <amount> <cadence> [memo]'"
+	}
+
+	lines := []string{"Recurring rules:"}
+	for i, rule := range m.budget.Recurring {
+		walletName := "(deleted wallet)"
+		if index, err := data.FindWallet(m.budget, rule.WalletID); err == nil {
+			walletName = m.budget.Wallets[index].Name
+		}
+		currency := m.ruleCurrency(rule)
+
+		line := fmt.Sprintf("%d. %s to %s, %s", i, m.formatSigned(rule.Amount, currency), walletName, rule.Describe())
+		if rule.Memo != "" {
+			line += " (" + rule.Memo + ")"
+		}
+		if rule.Expected {
+			line += " [expected]"
+		}
+		if rule.Paused {
+			line += " [paused]"
+		} else if next, ok := rule.NextOccurrence(time.Now()); ok {
+			line += ", next " + next.Format("2006-01-02")
+		} else {
+			line += ", ended"
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) handleAddRecurringCommand(expected bool, walletStr, amountStr string, rest []string) string {
+	wallet, errMsg := m.walletAt(walletStr)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	rule := data.RecurringRule{WalletID: wallet.ID, Expected: expected}
+
+	// The amount can be in another currency, e.g. "50 EUR monthly"
+	currency := wallet.Currency
+	if err := data.ParseCadence(rest[0], &rule); err != nil && len(rest) > 1 {
+		if unit, err := data.LookupUnit(rest[0]); err == nil {
+			currency = unit.Code
+			rule.Currency = currency
+			rest = rest[1:]
+		}
+	}
+	if err := data.ParseCadence(rest[0], &rule); err != nil {
+		return err.Error()
+	}
+	extra := rest[1:]
+
+	amount, err := data.ParseAmount(amountStr, currency)
+	if err != nil {
+		return fmt.Sprintf("Invalid amount: %v", err)
+	}
+	rule.Amount = amount
+
+	var memo []string
+	for _, arg := range extra {
+		if date, ok := strings.CutPrefix(arg, "from:"); ok {
+			rule.Start = date
+		} else if date, ok := strings.CutPrefix(arg, "until:"); ok {
+			rule.End = date
+		} else {
+			memo = append(memo, arg)
+		}
+	}
+	rule.Memo = strings.Join(memo, " ")
+
+	if err := data.AddRecurringRule(m.store, m.budget, rule); err != nil {
+		return m.handleSaveError(err, "add recurring rule")
+	}
+
+	added := m.budget.Recurring[len(m.budget.Recurring)-1]
+	if expected {
+		return fmt.Sprintf("Expecting %s in %s, %s", m.formatSigned(amount, currency), wallet.Name, added.Describe())
+	}
+
+	// A rule starting in the past catches up right away
+	if summary := m.applyDueRecurring(); summary != "" {
+		return "Rule added. " + summary
+	}
+	return fmt.Sprintf("Added %s to %s, %s", m.formatSigned(amount, currency), wallet.Name, added.Describe())
+}
+
+func (m *model) handleDeleteRecurringCommand(rule data.RecurringRule) string {
+	m.confirmationMessage = fmt.Sprintf("Delete the recurring %s (%s)? Transactions it already posted stay in the ledger.", m.formatSigned(rule.Amount, m.ruleCurrency(rule)), rule.Describe())
+	m.originScreen = walletScreen
+	m.confirmationAction = func() error {
+		return data.DeleteRecurringRule(m.store, m.budget, rule.ID)
+	}
+	m.onConfirm = func(m *model) (tea.Model, tea.Cmd) {
+		m.wallets, m.err = m.loadWallets()
+		m.commandResult = "Recurring rule deleted"
+		return m, nil
+	}
+	m.currentScreen = confirmationScreen
+
+	return ""
+}
+
+func (m *model) handleForecastCommand(days int) string {
+	forecast, err := data.ForecastBalances(m.budget, days, time.Now())
+	if err != nil {
+		return fmt.Sprintf("Failed to forecast: %v", err)
+	}
+
+	m.forecast = forecast
+	m.forecastOffset = 0
+	m.currentScreen = forecastScreen
+	return ""
+}
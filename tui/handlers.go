@@ -1,26 +1,148 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/kkrll/the-terminal-budget/data"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-func (m model) loadWallets() ([]Wallet, error) {
+// loadWallets reloads the open budget from disk and returns its wallets
+func (m *model) loadWallets() ([]Wallet, error) {
 	if m.currentPath == "" {
+		m.budget = nil
+		m.refreshTotals()
 		return []Wallet{}, nil
 	}
-	budgetFile, err := data.LoadBudgetFile(m.currentPath)
+	budgetFile, err := m.store.Load(m.currentPath)
 	if err != nil {
 		return nil, err
 	}
+	m.budget = budgetFile
+	m.refreshTotals()
 	return budgetFile.Wallets, nil
 }
 
+// handleSaveError reports a failed change. If the budget changed on disk since
+// it was loaded, the user chooses between overwriting it and reloading.
+func (m *model) handleSaveError(err error, action string) string {
+	var conflict *data.ConflictError
+	if !errors.As(err, &conflict) {
+		// Drop whatever was changed in memory but never saved
+		m.wallets, m.err = m.loadWallets()
+		return fmt.Sprintf("Failed to %s: %v", action, err)
+	}
+
+	m.confirmationMessage = fmt.Sprintf("Budget '%s' was changed elsewhere since you opened it.\nOverwrite it with your changes? Choosing No reloads it and discards them.", conflict.Name)
+	m.originScreen = walletScreen
+	m.confirmationAction = func() error {
+		return m.store.ForceSave(m.budget)
+	}
+	m.onConfirm = func(m *model) (tea.Model, tea.Cmd) {
+		m.wallets, m.err = m.loadWallets()
+		m.commandResult = "Saved your changes over the newer version"
+		return m, nil
+	}
+	m.onCancel = func(m *model) (tea.Model, tea.Cmd) {
+		m.wallets, m.err = m.loadWallets()
+		m.commandResult = "Reloaded the budget from disk"
+		return m, nil
+	}
+	m.currentScreen = confirmationScreen
+
+	return ""
+}
+
+// openBudget locks the budget and switches to the wallet screen. If another
+// process already has it open, the budget is shown read-only instead.
+func (m *model) openBudget(slug string) {
+	m.closeBudget()
+
+	m.currentPath = slug
+	if locker, ok := m.store.(data.Locker); ok {
+		lock, err := locker.Lock(slug)
+		if err != nil {
+			m.readOnly = true
+			m.commandResult = fmt.Sprintf("Opened read-only: %v", err)
+		}
+		m.budgetLock = lock
+	}
+
+	m.wallets, m.err = m.loadWallets()
+	m.currentScreen = walletScreen
+
+	if m.err == nil && !m.readOnly {
+		var summaries []string
+		if summary := m.applyDueRecurring(); summary != "" {
+			summaries = append(summaries, summary)
+		}
+		if summary := m.revalueHoldings(); summary != "" {
+			summaries = append(summaries, summary)
+		}
+		if len(summaries) > 0 {
+			m.commandResult = strings.Join(summaries, "\n")
+		}
+	}
+}
+
+// revalueHoldings prices holdings when the budget opens and reports any
+// symbol that has no price
+func (m *model) revalueHoldings() string {
+	unpriced, err := data.RevalueHoldings(m.store, m.budget, data.DefaultPrices(m.budget))
+	if err != nil {
+		return m.handleSaveError(err, "revalue holdings")
+	}
+	m.wallets, m.err = m.loadWallets()
+
+	if len(unpriced) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("No price for %s; set one with 'price <symbol> <value>'", strings.Join(unpriced, ", "))
+}
+
+// maxPostedLines is how many posted recurring transactions are listed on open
+const maxPostedLines = 5
+
+// applyDueRecurring posts recurring transactions that came due since the
+// budget was last opened and returns a summary of them
+func (m *model) applyDueRecurring() string {
+	posted, err := data.ApplyDueRecurring(m.store, m.budget, time.Now())
+	if err != nil {
+		return m.handleSaveError(err, "post recurring transactions")
+	}
+	if len(posted) == 0 {
+		return ""
+	}
+
+	m.wallets, m.err = m.loadWallets()
+
+	lines := []string{fmt.Sprintf("Posted %d recurring transaction(s):", len(posted))}
+	for i, occurrence := range posted {
+		if i == maxPostedLines {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(posted)-maxPostedLines))
+			break
+		}
+		line := fmt.Sprintf("%s  %s to %s", occurrence.Date.Format("2006-01-02"), m.formatSigned(occurrence.Amount, occurrence.Currency), occurrence.Wallet)
+		if occurrence.Rule.Memo != "" {
+			line += " (" + occurrence.Rule.Memo + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) closeBudget() {
+	m.budgetLock.Release()
+	m.budgetLock = nil
+	m.readOnly = false
+	m.commandResult = ""
+}
+
 func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 	input := strings.TrimSpace(m.creationInput)
 
@@ -50,7 +172,12 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 			if input == "" {
 				return m, nil // Custom currency required
 			}
-			m.creationData.Currency = strings.ToUpper(input)
+			unit, err := data.LookupUnit(input)
+			if err != nil {
+				m.creationError = err.Error()
+				return m, nil // Unknown currency, stay on this step
+			}
+			m.creationData.Currency = unit.Code
 		} else if m.selectedOption < len(m.creationOptions)-1 {
 			m.creationData.Currency = m.creationOptions[m.selectedOption]
 		} else {
@@ -71,14 +198,21 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 			return m, nil // Switch to custom input mode
 		}
 
-	case 4: // Balance
-		var balance float64
-		if input == "" {
-			balance = 0.0
-		} else {
+		if m.creationPrefilled && !m.editedCurrencyChanged() {
+			return m.saveEditedWallet(false)
+		}
+
+	case 4: // Balance, or when editing, what to do with it after a currency change
+		if m.creationPrefilled {
+			return m.saveEditedWallet(m.selectedOption == 0)
+		}
+
+		balance := data.NewMoney(0, data.CurrencyExponent(m.creationData.Currency))
+		if input != "" {
 			var err error
-			balance, err = strconv.ParseFloat(input, 64)
+			balance, err = data.ParseAmount(input, m.creationData.Currency)
 			if err != nil {
+				m.creationError = err.Error()
 				return m, nil // Invalid balance, stay on this step
 			}
 		}
@@ -86,7 +220,8 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 
 		// Final step - create the wallet
 		err := data.CreateWallet(
-			m.currentPath,
+			m.store,
+			m.budget,
 			m.creationData.Name,
 			m.creationData.Owner,
 			m.creationData.Type,
@@ -94,8 +229,16 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 			m.creationData.Balance,
 		)
 
+		var conflict *data.ConflictError
+		if errors.As(err, &conflict) {
+			m.commandResult = m.handleSaveError(err, "create wallet")
+			return m, nil
+		}
 		if err != nil {
-			// Could show error, but for now just stay on creation screen
+			// Stay in the wizard so the input can be fixed, and drop the
+			// wallet if it was added in memory but never saved
+			m.creationError = fmt.Sprintf("Failed to create wallet: %v", err)
+			m.wallets, m.err = m.loadWallets()
 			return m, nil
 		}
 
@@ -106,6 +249,7 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 	}
 
 	// Move to next step
+	m.creationError = ""
 	m.creationStep++
 	m.creationInput = ""
 	m.creationCursorPos = 0
@@ -120,17 +264,124 @@ func (m *model) handleCreationStep() (tea.Model, tea.Cmd) {
 		m.populateCurrencyOptions()
 	case 3:
 		m.populateOwnerOptions()
+	case 4:
+		if m.creationPrefilled {
+			m.populateConversionOptions()
+			break
+		}
+		fallthrough
 	default:
 		m.creationOptions = []string{}
 	}
+	m.prefillCreationStep()
 
 	return m, nil
 }
 
+// creationTakesText reports whether the current wizard step reads typed text
+func (m *model) creationTakesText() bool {
+	return m.creationStep == 0 || (m.creationStep == 4 && !m.creationPrefilled) || m.isCustomInput
+}
+
+// prefillCreationStep starts the current wizard step with the value of the
+// wallet being edited: its option selected, or typed into the input
+func (m *model) prefillCreationStep() {
+	if !m.creationPrefilled {
+		return
+	}
+
+	var value string
+	switch m.creationStep {
+	case 0:
+		value = m.creationData.Name
+	case 1:
+		value = m.creationData.Type
+	case 2:
+		value = m.creationData.Currency
+	case 3:
+		value = m.creationData.Owner
+	default:
+		return
+	}
+
+	if m.creationStep > 0 {
+		// The last option is always the custom one
+		if i := slices.Index(m.creationOptions[:len(m.creationOptions)-1], value); i >= 0 {
+			m.selectedOption = i
+			return
+		}
+		m.selectedOption = len(m.creationOptions) - 1
+		m.isCustomInput = true
+	}
+	m.creationInput = value
+	m.creationCursorPos = len(value)
+}
+
+// editedWallet returns the wallet being edited as it is stored
+func (m *model) editedWallet() (Wallet, bool) {
+	index, err := data.FindWallet(m.budget, m.creationData.ID)
+	if err != nil {
+		return Wallet{}, false
+	}
+	return m.budget.Wallets[index], true
+}
+
+func (m *model) editedCurrencyChanged() bool {
+	original, ok := m.editedWallet()
+	return ok && original.Currency != m.creationData.Currency
+}
+
+// populateConversionOptions offers to convert the balance of an edited
+// wallet to its new currency or to keep the number
+func (m *model) populateConversionOptions() {
+	original, _ := m.editedWallet()
+	currency := m.creationData.Currency
+
+	convert := "Convert at today's rate (no rate available)"
+	if base, err := data.GetDefaultCurrency(m.budget); err == nil {
+		if converted, err := data.ConvertCurrency(original.Balance, original.Currency, currency, base, m.budget.RateOverrides); err == nil {
+			convert = "Convert at today's rate: " + m.formatAmount(converted, currency)
+		}
+	}
+	keep := "Keep the number: " + m.formatAmount(original.Balance, currency)
+
+	m.creationOptions = []string{convert, keep}
+}
+
+func (m *model) saveEditedWallet(convert bool) (tea.Model, tea.Cmd) {
+	err := data.EditWallet(
+		m.store,
+		m.budget,
+		m.creationData.ID,
+		m.creationData.Name,
+		m.creationData.Owner,
+		m.creationData.Type,
+		m.creationData.Currency,
+		convert,
+	)
+
+	var conflict *data.ConflictError
+	if errors.As(err, &conflict) {
+		m.commandResult = m.handleSaveError(err, "edit wallet")
+		return m, nil
+	}
+	if err != nil {
+		m.creationError = err.Error()
+		m.wallets, m.err = m.loadWallets()
+		return m, nil
+	}
+
+	m.currentScreen = walletScreen
+	m.wallets, m.err = m.loadWallets()
+	m.commandResult = fmt.Sprintf("Saved changes to %s", m.creationData.Name)
+	m.creationPrefilled = false
+	return m, nil
+}
+
 func (m *model) populateTypeOptions() {
-	budgetFile, err := data.LoadBudgetFile(m.currentPath)
+	budgetFile, err := m.store.Load(m.currentPath)
 	if err != nil {
-		m.creationOptions = []string{"cash", "bank", "invest", "custom: enter new type..."}
+		m.creationOptions = []string{"cash", "bank", "invest", data.TypeCreditCard, data.TypeLoan, "custom: enter new type..."}
 		return
 	}
 
@@ -142,7 +393,7 @@ func (m *model) populateTypeOptions() {
 
 	var options []string
 	if len(budgetFile.Wallets) == 0 {
-		options = []string{"bank", "cash", "invest"}
+		options = []string{"bank", "cash", "invest", data.TypeCreditCard, data.TypeLoan, data.TypeMortgage}
 	} else {
 		for walletType := range typeSet {
 			options = append(options, walletType)
@@ -159,7 +410,7 @@ func (m *model) populateTypeOptions() {
 }
 
 func (m *model) populateCurrencyOptions() {
-	budgetFile, err := data.LoadBudgetFile(m.currentPath)
+	budgetFile, err := m.store.Load(m.currentPath)
 	if err != nil {
 		m.creationOptions = []string{"USD", "EUR", "GBP", "custom: enter currency code..."}
 		return
@@ -190,7 +441,7 @@ func (m *model) populateCurrencyOptions() {
 }
 
 func (m *model) populateOwnerOptions() {
-	budgetFile, err := data.LoadBudgetFile(m.currentPath)
+	budgetFile, err := m.store.Load(m.currentPath)
 	if err != nil {
 		m.creationOptions = []string{"User", "custom: enter owner name..."}
 		return
@@ -239,9 +490,19 @@ func (m *model) handleGreetingInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		} else {
 			// Load selected budget file
 			selectedFile := m.availableFiles[m.selectedFileIndex]
-			m.currentPath = selectedFile.Name
-			m.wallets = selectedFile.Wallets
-			m.currentScreen = walletScreen
+			if selectedFile.Locked() {
+				m.promptPassphrase(fmt.Sprintf("Enter the passphrase for '%s'", selectedFile.Name), false,
+					func(m *model, passphrase string) error {
+						if err := m.store.Unlock(selectedFile.Slug, passphrase); err != nil {
+							return err
+						}
+						CleanSlates(m)
+						m.openBudget(selectedFile.Slug)
+						return nil
+					})
+				return m, nil
+			}
+			m.openBudget(selectedFile.Slug)
 		}
 		return m, nil
 	case "esc":
@@ -253,11 +514,11 @@ func (m *model) handleGreetingInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.confirmationMessage = fmt.Sprintf("Are you sure you want to delete the budget file '%s'?", selectedFile.Name)
 			m.originScreen = greetingScreen
 			m.confirmationAction = func() error {
-				return data.DeleteBudgetFile(selectedFile.Name)
+				return m.store.Delete(selectedFile.Slug)
 			}
 			m.onConfirm = func(m *model) (tea.Model, tea.Cmd) {
 				// After deletion, refresh the file list and return to greeting screen
-				m.availableFiles, m.err = data.ListBudgetFiles()
+				m.availableFiles, m.err = m.store.List()
 				if m.err != nil {
 					m.err = fmt.Errorf("failed to list budget files: %v", m.err)
 				}
@@ -294,7 +555,7 @@ func (m *model) handleBudgetCreationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleBudgetFileCreation()
 	case "esc":
 		m.currentScreen = greetingScreen
-		m.availableFiles, m.err = data.ListBudgetFiles()
+		m.availableFiles, m.err = m.store.List()
 		if m.err != nil {
 			m.err = fmt.Errorf("failed to list budget files: %v", m.err)
 		}
@@ -331,10 +592,16 @@ func (m *model) handleConfirmationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.confirmationAction != nil {
 			err := m.confirmationAction()
 			if err != nil {
-				m.err = fmt.Errorf("action failed: %v", err)
 				originScreen := m.originScreen // Save origin screen before cleanup
 				CleanSlates(m)
 				m.currentScreen = originScreen
+
+				var conflict *data.ConflictError
+				if errors.As(err, &conflict) {
+					m.commandResult = m.handleSaveError(err, "save")
+					return m, nil
+				}
+				m.err = fmt.Errorf("action failed: %v", err)
 				return m, nil
 			} else if m.onConfirm != nil {
 				onConfirmFunc := m.onConfirm
@@ -349,9 +616,13 @@ func (m *model) handleConfirmationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.currentScreen = originScreen
 		return m, nil
 	case "n", "N", "esc":
+		onCancelFunc := m.onCancel
 		originScreen := m.originScreen // Save origin screen before cleanup
 		CleanSlates(m)
 		m.currentScreen = originScreen
+		if onCancelFunc != nil {
+			return onCancelFunc(m)
+		}
 		return m, nil
 	}
 	return m, nil
@@ -363,11 +634,14 @@ func (m *model) handleWalletInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "enter":
 		m.commandResult = m.HandleCommand(m.commandInput)
 		m.commandInput = ""
+		// Filters, hidden wallets, the display currency and offline mode all change the totals
+		m.refreshTotals()
 		m.cursorPos = 0
 		return m, nil
 	case "esc":
+		m.closeBudget()
 		m.currentScreen = greetingScreen
-		m.availableFiles, m.err = data.ListBudgetFiles()
+		m.availableFiles, m.err = m.store.List()
 		if m.err != nil {
 			m.err = fmt.Errorf("failed to list budget files: %v", m.err)
 		}
@@ -408,18 +682,18 @@ func (m *model) handleWalletCreationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		CleanSlates(m)
 		return m, nil
 	case "backspace":
-		if len(m.creationInput) > 0 && m.creationCursorPos > 0 && (m.creationStep == 0 || m.creationStep == 4 || m.isCustomInput) {
+		if len(m.creationInput) > 0 && m.creationCursorPos > 0 && m.creationTakesText() {
 			m.creationInput = m.creationInput[:m.creationCursorPos-1] + m.creationInput[m.creationCursorPos:]
 			m.creationCursorPos--
 		}
 		return m, nil
 	case "left":
-		if m.creationCursorPos > 0 && (m.creationStep == 0 || m.creationStep == 4 || m.isCustomInput) {
+		if m.creationCursorPos > 0 && m.creationTakesText() {
 			m.creationCursorPos--
 		}
 		return m, nil
 	case "right":
-		if m.creationCursorPos < len(m.creationInput) && (m.creationStep == 0 || m.creationStep == 4 || m.isCustomInput) {
+		if m.creationCursorPos < len(m.creationInput) && m.creationTakesText() {
 			m.creationCursorPos++
 		}
 		return m, nil
@@ -431,8 +705,8 @@ func (m *model) handleWalletCreationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.selectedOption++
 			}
 
-			// Check if "custom input" option is selected
-			m.isCustomInput = (m.selectedOption == len(m.creationOptions)-1)
+			// Check if "custom input" option is selected; the conversion choice has none
+			m.isCustomInput = m.creationStep < 4 && m.selectedOption == len(m.creationOptions)-1
 			if !m.isCustomInput {
 				m.creationInput = ""
 				m.creationCursorPos = 0
@@ -441,7 +715,7 @@ func (m *model) handleWalletCreationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	default:
 		// Handle text input only for appropriate steps
-		if m.creationStep == 0 || m.creationStep == 4 || m.isCustomInput {
+		if m.creationTakesText() {
 			m.creationInput = m.creationInput[:m.creationCursorPos] + msg.String() + m.creationInput[m.creationCursorPos:]
 			m.creationCursorPos++
 		}
@@ -450,24 +724,102 @@ func (m *model) handleWalletCreationInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) handleBudgetFileCreation() (tea.Model, tea.Cmd) {
-	filename := m.creationInput
+	name := m.creationInput
 
-	if filename == "" {
+	if err := data.ValidateBudgetName(name); err != nil {
+		m.creationError = err.Error()
 		return m, nil
 	}
 
-	err := data.CreateBudgetFile(filename)
+	budgetFile, err := m.store.Create(name)
 	if err != nil {
+		m.creationError = err.Error()
 		return m, nil
 	}
 
-	m.currentPath = filename
-	m.wallets = []Wallet{}
-	m.currentScreen = walletScreen
+	m.openBudget(budgetFile.Slug)
 
 	m.creationCursorPos = 0
 	m.creationInput = ""
+	m.creationError = ""
 	m.isNewFile = false
 
 	return m, nil
 }
+
+// promptPassphrase switches to the passphrase screen. action runs with what
+// was typed; if it fails, its error is shown and the user can try again.
+func (m *model) promptPassphrase(prompt string, repeat bool, action func(m *model, passphrase string) error) {
+	m.passphrasePrompt = prompt
+	m.passphraseInput = ""
+	m.passphraseFirst = ""
+	m.passphraseRepeat = repeat
+	m.passphraseError = ""
+	m.passphraseAction = action
+	m.originScreen = m.currentScreen
+	m.currentScreen = passphraseScreen
+}
+
+// Passphrase screen input handling
+func (m *model) handlePassphraseInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		if m.passphraseInput == "" {
+			m.passphraseError = "Passphrase can't be empty"
+			return m, nil
+		}
+		if m.passphraseRepeat && m.passphraseFirst == "" {
+			m.passphraseFirst = m.passphraseInput
+			m.passphraseInput = ""
+			m.passphraseError = ""
+			return m, nil
+		}
+		if m.passphraseRepeat && m.passphraseInput != m.passphraseFirst {
+			m.passphraseFirst = ""
+			m.passphraseInput = ""
+			m.passphraseError = "Passphrases don't match, try again"
+			return m, nil
+		}
+
+		if err := m.passphraseAction(m, m.passphraseInput); err != nil {
+			m.passphraseInput = ""
+			m.passphraseError = err.Error()
+		}
+		return m, nil
+	case tea.KeyEsc:
+		originScreen := m.originScreen
+		CleanSlates(m)
+		m.currentScreen = originScreen
+		return m, nil
+	case tea.KeyBackspace:
+		if len(m.passphraseInput) > 0 {
+			runes := []rune(m.passphraseInput)
+			m.passphraseInput = string(runes[:len(runes)-1])
+		}
+		return m, nil
+	case tea.KeyRunes, tea.KeySpace:
+		m.passphraseInput += string(msg.Runes)
+		m.passphraseError = ""
+		return m, nil
+	}
+	return m, nil
+}
+
+// Forecast screen input handling
+func (m *model) handleForecastInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "enter":
+		m.forecast = nil
+		m.forecastOffset = 0
+		m.currentScreen = walletScreen
+	case "up":
+		if m.forecastOffset > 0 {
+			m.forecastOffset--
+		}
+	case "down":
+		if m.forecastOffset < len(m.forecastRows())-forecastVisibleRows {
+			m.forecastOffset++
+		}
+	}
+	return m, nil
+}
@@ -3,6 +3,8 @@ package tui
 import (
 	"fmt"
 	"time"
+
+	"github.com/kkrll/the-terminal-budget/data"
 )
 
 func truncate(s string, length int) string {
@@ -19,6 +21,32 @@ func firstN(s string, n int) string {
 	return s
 }
 
+// formatAmount prints an amount with its currency's precision, followed by
+// the code, or with the currency's symbol when symbols are shown
+func (m model) formatAmount(amount data.Money, currency string) string {
+	if m.showSymbols {
+		return data.FormatWithSymbol(amount, currency)
+	}
+	return fmt.Sprintf("%s %s", data.FormatAmount(amount, currency), currency)
+}
+
+// formatSigned is formatAmount with an explicit + for positive values
+func (m model) formatSigned(amount data.Money, currency string) string {
+	if amount.Sign() >= 0 {
+		return "+" + m.formatAmount(amount, currency)
+	}
+	return m.formatAmount(amount, currency)
+}
+
+// formatBalance prints an amount for a column that already names the
+// currency: just the number, or with the symbol when symbols are shown
+func (m model) formatBalance(amount data.Money, currency string) string {
+	if m.showSymbols && data.CurrencySymbol(currency) != "" {
+		return data.FormatWithSymbol(amount, currency)
+	}
+	return data.FormatAmount(amount, currency)
+}
+
 func formatTimeAgo(t time.Time) string {
 	now := time.Now()
 	duration := now.Sub(t)
@@ -57,17 +85,28 @@ func CleanSlates(m *model) {
 	m.creationStep = 0
 	m.selectedOption = 0
 	m.isCustomInput = false
+	m.creationPrefilled = false
 
 	// File selection state
 	m.selectedFileIndex = 0
 	m.isNewFile = false
+	m.creationError = ""
 
 	// Confirmation state
 	m.confirmationMessage = ""
 	m.confirmationAction = nil
 	m.onConfirm = nil
+	m.onCancel = nil
 	m.originScreen = greetingScreen
 
+	// Passphrase state
+	m.passphrasePrompt = ""
+	m.passphraseInput = ""
+	m.passphraseFirst = ""
+	m.passphraseRepeat = false
+	m.passphraseError = ""
+	m.passphraseAction = nil
+
 	// Error state
 	m.err = nil
 }
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
 
@@ -117,10 +118,16 @@ func (m model) createFileSelectionList() string {
 			prefix = "[ ] "
 		}
 
+		// The lock is two cells wide, so unencrypted budgets get two spaces
+		lockIcon := "  "
+		if file.Encrypted {
+			lockIcon = "🔒"
+		}
+
 		displayName := truncate(file.Name, 20)
 		// Format the time nicely
 		timeAgo := formatTimeAgo(file.UpdatedAt)
-		item := fmt.Sprintf("%s%-20s Updated %s", prefix, displayName, timeAgo)
+		item := fmt.Sprintf("%s%s %-20s Updated %s", prefix, lockIcon, displayName, timeAgo)
 		items = append(items, item)
 	}
 
@@ -131,7 +138,7 @@ func (m model) createFileSelectionList() string {
 	} else {
 		prefix = "[ ] "
 	}
-	items = append(items, prefix+"Create new budget...")
+	items = append(items, prefix+"   Create new budget...")
 
 	return lipgloss.NewStyle().
 		Align(lipgloss.Left).
@@ -165,11 +172,62 @@ func (m model) ConfirmationView() string {
 	)
 }
 
+func (m model) PassphraseView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Render(m.passphrasePrompt)
+
+	label := "Passphrase:"
+	if m.passphraseRepeat && m.passphraseFirst != "" {
+		label = "Type it again to confirm:"
+	}
+
+	input := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Padding(0, 1).
+		Width(40).
+		Render(strings.Repeat("•", len([]rune(m.passphraseInput))) + "█")
+
+	errorLine := ""
+	if m.passphraseError != "" {
+		errorLine = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF0000")).
+			Render(m.passphraseError)
+	}
+
+	instructions := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#626262")).
+		Render("⏎ to continue  |  Esc to cancel")
+
+	content := lipgloss.JoinVertical(
+		lipgloss.Center,
+		title,
+		"",
+		label,
+		input,
+		errorLine,
+		instructions,
+	)
+
+	return lipgloss.Place(
+		m.width, m.height,
+		lipgloss.Center, lipgloss.Center,
+		content,
+	)
+}
+
 func (m model) BudgetCreationView() string {
 	title := lipgloss.NewStyle().
 		Bold(true).
 		Render("CREATE NEW BUDGET")
 
+	errorLine := ""
+	if m.creationError != "" {
+		errorLine = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF0000")).
+			Render(m.creationError)
+	}
+
 	content := lipgloss.JoinVertical(
 		lipgloss.Center,
 		title,
@@ -177,7 +235,7 @@ func (m model) BudgetCreationView() string {
 		"Enter budget name:",
 		"",
 		m.createTextInput(),
-		"",
+		errorLine,
 		m.createCreationInstructions())
 
 	return lipgloss.Place(
@@ -207,6 +265,8 @@ func (m model) walletsView() string {
 
 	commandHints := m.createCommandHints()
 
+	commandResult := m.createCommandResult()
+
 	if len(m.wallets) == 0 {
 		emptyMsg := lipgloss.NewStyle().
 			Render("No wallets found. Would you like to create one?")
@@ -218,6 +278,7 @@ func (m model) walletsView() string {
 			"",
 			"",
 			inputBox,
+			commandResult,
 			commandHints,
 		)
 
@@ -235,6 +296,7 @@ func (m model) walletsView() string {
 		"",
 		"",
 		inputBox,
+		commandResult,
 		commandHints,
 	)
 
@@ -246,9 +308,16 @@ func (m model) walletsView() string {
 }
 
 func (m model) createWalletTable() string {
+	titleText := "YOUR BUDGET"
+	if m.budget != nil && m.budget.Encrypted {
+		titleText += " 🔒"
+	}
+	if m.readOnly {
+		titleText += " (read-only)"
+	}
 	title := lipgloss.NewStyle().
 		Bold(true).
-		Render("YOUR BUDGET")
+		Render(titleText)
 
 	headers := []string{"Name", "Owner", "Type", "Balance", "Currency"}
 
@@ -265,17 +334,21 @@ func (m model) createWalletTable() string {
 	rows = append(rows, separator)
 
 	for i, wallet := range m.wallets {
-		row := fmt.Sprintf("%2d. %-15s %-12s %-10s %10.2f  %-8s",
+		currency := wallet.Currency
+		if utilization, ok := wallet.Utilization(); ok {
+			currency += fmt.Sprintf(" %.0f%%", utilization*100)
+		}
+		row := fmt.Sprintf("%2d. %-15s %-12s %-10s %10s  %-8s",
 			i,
 			truncate(wallet.Name, 15),
 			truncate(wallet.Owner, 12),
 			truncate(wallet.Type, 10),
-			wallet.Balance,
-			wallet.Currency,
+			m.formatBalance(wallet.Balance, wallet.Currency),
+			currency,
 		)
 
 		var isExscluded bool = false
-		if m.hiddenIndexes[i] {
+		if m.hiddenWallets[wallet.ID] {
 			isExscluded = true
 		}
 		if m.filterOwner != "" && wallet.Owner != m.filterOwner {
@@ -300,26 +373,45 @@ func (m model) createWalletTable() string {
 		rows = append(rows, displayRow)
 	}
 
-	total := m.calculateTotal()
+	total := m.renderTotals()
 	rows = append(rows, separator)
 	rows = append(rows, total)
 
 	return strings.Join(rows, "\n")
 }
 
-func (m model) calculateTotal() string {
-	if len(m.wallets) == 0 {
-		return "0 wallets                                     0.00"
-	}
+// walletTotals is the footer of the wallet table. Converting balances reads
+// the rate cache and the price file, so it is worked out by refreshTotals when
+// the budget, filters or display currency change rather than on every render.
+type walletTotals struct {
+	currency    string
+	assets      data.Money
+	liabilities data.Money
+	netWorth    data.Money
+	outOfRange  bool // net worth doesn't fit in an amount
+	count       int  // visible wallets
+	err         error
+
+	// When the rates behind converted balances were fetched, if they are stale
+	// or offline; zero otherwise
+	ratesAsOf  time.Time
+	offline    bool
+	overridden []string // currencies converted with a manual rate
+	// Wallets left out because they couldn't be converted or summed
+	unconverted []string
+}
 
-	budgetData, err := data.LoadBudgetFile(m.currentPath)
-	if err != nil {
-		return fmt.Sprintf("Error loading budget data: %v", err)
+// refreshTotals works out the footer for the visible wallets of the open budget
+func (m *model) refreshTotals() {
+	m.totals = walletTotals{}
+	if m.budget == nil || len(m.budget.Wallets) == 0 {
+		return
 	}
 
-	defaultCurrency, err := data.GetDefaultCurrency(budgetData)
+	defaultCurrency, err := data.GetDefaultCurrency(m.budget)
 	if err != nil {
-		return fmt.Sprintf("Error getting default currency: %v", err)
+		m.totals.err = err
+		return
 	}
 
 	// Use display currency if set, otherwise use default currency
@@ -328,12 +420,16 @@ func (m model) calculateTotal() string {
 		targetCurrency = m.displayCurrency
 	}
 
-	total := 0.0
-	visibleCount := 0
+	totals := &m.totals
+	exp := data.CurrencyExponent(targetCurrency)
+	totals.currency = targetCurrency
+	totals.assets = data.NewMoney(0, exp)
+	totals.liabilities = data.NewMoney(0, exp)
+	converted := false
 
-	for i, wallet := range m.wallets {
+	for _, wallet := range m.budget.Wallets {
 		// Skip hidden or filtered wallets
-		if m.hiddenIndexes[i] {
+		if m.hiddenWallets[wallet.ID] {
 			continue
 		}
 		if m.filterOwner != "" && wallet.Owner != m.filterOwner {
@@ -346,33 +442,102 @@ func (m model) calculateTotal() string {
 			continue
 		}
 
-		visibleCount++
+		totals.count++
 
-		if wallet.Currency == targetCurrency {
-			total += wallet.Balance
-		} else {
-			converted, err := data.ConvertCurrency(wallet.Balance, wallet.Currency, targetCurrency, defaultCurrency)
+		balance := wallet.Balance
+		if wallet.Currency != targetCurrency {
+			// A raw foreign balance would make the total wrong, so leave it out and say so
+			convertedBalance, err := data.ConvertCurrency(wallet.Balance, wallet.Currency, targetCurrency, defaultCurrency, m.budget.RateOverrides)
 			if err != nil {
-				total += wallet.Balance
-			} else {
-				total += converted
+				totals.unconverted = append(totals.unconverted, wallet.Name)
+				continue
+			}
+			balance = convertedBalance
+			converted = true
+			if m.budget.RateOverrides.Applies(wallet.Currency, targetCurrency, defaultCurrency) &&
+				!slices.Contains(totals.overridden, wallet.Currency) {
+				totals.overridden = append(totals.overridden, wallet.Currency)
 			}
 		}
+
+		total := &totals.assets
+		if wallet.IsLiability() {
+			total = &totals.liabilities
+		}
+		sum, err := total.Add(balance)
+		if err != nil {
+			totals.unconverted = append(totals.unconverted, wallet.Name)
+			continue
+		}
+		*total = sum
 	}
 
-	walletCount := fmt.Sprintf("%d wallet", visibleCount)
-	if visibleCount != 1 {
+	totals.netWorth, err = totals.assets.Sub(totals.liabilities)
+	totals.outOfRange = err != nil
+
+	if converted {
+		if rates, ok := data.RatesAsOf(defaultCurrency); ok && (!rates.Fresh() || data.IsOffline()) {
+			totals.ratesAsOf = rates.AsOf()
+			totals.offline = data.IsOffline()
+		}
+	}
+}
+
+// renderTotals shows the footer worked out by refreshTotals
+func (m model) renderTotals() string {
+	if len(m.wallets) == 0 {
+		return "0 wallets                                     0.00"
+	}
+
+	totals := m.totals
+	if totals.err != nil {
+		return fmt.Sprintf("Error getting default currency: %v", totals.err)
+	}
+
+	walletCount := fmt.Sprintf("%d wallet", totals.count)
+	if totals.count != 1 {
 		walletCount += "s"
 	}
+
+	netWorth := "out of range"
+	if !totals.outOfRange {
+		netWorth = m.formatAmount(totals.netWorth, totals.currency)
+	}
+	lines := []string{
+		footerLine("Assets", m.formatAmount(totals.assets, totals.currency)),
+		footerLine("Liabilities", m.formatAmount(totals.liabilities, totals.currency)),
+		footerLine(walletCount+" · Net worth", netWorth),
+	}
+
+	notice := lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+	if !totals.ratesAsOf.IsZero() {
+		status := "rates as of " + formatTimeAgo(totals.ratesAsOf)
+		if totals.offline {
+			status = "offline · " + status
+		}
+		lines = append(lines, notice.Render(status))
+	}
+	if len(totals.overridden) > 0 {
+		lines = append(lines, notice.Width(64).Render(
+			fmt.Sprintf("Manual rate used for %s to %s, see 'rate'", strings.Join(totals.overridden, ", "), totals.currency)))
+	}
+	if len(totals.unconverted) > 0 {
+		lines = append(lines, notice.Width(64).Render(
+			fmt.Sprintf("Not counted, no %s rate: %s", totals.currency, strings.Join(totals.unconverted, ", "))))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// footerLine puts left and right at the edges of the wallet table
+func footerLine(left, right string) string {
 	totalWidth := 64
-	leftSide := walletCount
-	rightSide := fmt.Sprintf("%.2f %s", total, targetCurrency)
-	spacing := totalWidth - len(leftSide) - len(rightSide)
+	spacing := totalWidth - lipgloss.Width(left) - lipgloss.Width(right)
 	if spacing < 1 {
 		spacing = 1
 	}
 
-	return fmt.Sprintf("%s%s%s", leftSide, strings.Repeat(" ", spacing), rightSide)
+	return fmt.Sprintf("%s%s%s", left, strings.Repeat(" ", spacing), right)
 }
 
 func (m model) createInputBox() string {
@@ -400,6 +565,16 @@ func (m model) createInputBox() string {
 	return inputBox
 }
 
+func (m model) createCommandResult() string {
+	if m.commandResult == "" {
+		return ""
+	}
+
+	return lipgloss.NewStyle().
+		Width(64).
+		Render(m.commandResult)
+}
+
 func (m model) createCommandHints() string {
 
 	var line1, line2, line3 string
@@ -411,25 +586,98 @@ func (m model) createCommandHints() string {
 		line1 = "Filter calculated wallets by owner, type, or currency:"
 		line2 = "'filter owner <name>' | 'filter type <type>' | 'filter currency <code>' | 'filter reset'"
 		line3 = "'filter reset' clears all the filters applied."
-	case "hi":
-		line1 = "Exclude wallets from calculations by index:"
-		line2 = "'hide 0,2,3' (comma-separated indexes)"
 	case "cu":
 		line1 = "Set display currency for total calculation:"
 		line2 = "'currency <CURRENCY_CODE>' (e.g., USD, EUR, GBP)"
+	case "di":
+		line1 = "Choose how amounts show their currency:"
+		line2 = "'display symbols' ($12.50, ¥1200) | 'display codes' (12.50 USD, 1200 JPY)"
+	case "ed":
+		line1 = "Change a wallet's name, owner, type or currency:"
+		line2 = "'edit <index>' opens the wallet wizard with its current values"
+		line3 = "Changing the currency asks whether to convert the balance or keep the number."
 	case "ne":
 		line1 = "Create new wallet:"
 		line2 = "command 'new' launches wallet creation wizard"
 	case "ad":
 		line1 = "Adjust wallet balance by index:"
-		line2 = "'adjust <index> <amount>'"
-		line3 = "(e.g., 'adjust 0 +100', 'adjust 1 -50', 'adjust 2 500')"
+		line2 = "'adjust <index> <amount> [memo]'"
+		line3 = "(e.g., 'adjust 0 +100 salary', 'adjust 1 -50', 'adjust 2 500')"
 	case "de":
-		line1 = "Delete wallet by index:"
-		line2 = "'delete <index>'"
+		if firstN(m.commandInput, 3) == "dec" {
+			line1 = "Remove encryption from this budget:"
+			line2 = "'decrypt' stores it as plain JSON again"
+		} else {
+			line1 = "Delete wallet by index:"
+			line2 = "'delete <index>'"
+		}
+	case "hi":
+		if firstN(m.commandInput, 3) == "his" {
+			line1 = "Show net worth over time, with the change between periods:"
+			line2 = "'history [day|week|month]' (defaults to day)"
+		} else {
+			line1 = "Exclude wallets from calculations by index:"
+			line2 = "'hide 0,2,3' (comma-separated indexes)"
+		}
+	case "re":
+		if firstN(m.commandInput, 3) == "rec" {
+			line1 = "Post a transaction on a schedule; due ones are posted when the budget opens:"
+			line2 = "'recurring' lists rules | 'recurring add|expect <wallet> <amount> [currency] <cadence> [from:] [until:] [memo]'"
+			line3 = "'recurring pause|resume|delete <n>' (cadence: daily, weekly, monthly, yearly, 2nd-fri, last-mon)"
+			break
+		}
+		fallthrough
+	case "un":
+		if firstN(m.commandInput, 3) == "uni" {
+			line1 = "Currencies, crypto, commodities and your own units like air miles:"
+			line2 = "'units' lists them | 'units add <CODE> <decimals> [<rate> <currency>] [name]' | 'units remove <CODE>'"
+			line3 = "Units without a rate are priced from the price file."
+			break
+		}
+		line1 = "Step back and forth through your changes, even after a restart:"
+		line2 = "'undo [steps]' | 'redo [steps]'"
+		if entry, ok := data.NextUndo(m.budget); ok && currentCommand == "un" {
+			line3 = "Next undo: " + entry.Description
+		} else if entry, ok := data.NextRedo(m.budget); ok && currentCommand == "re" {
+			line3 = "Next redo: " + entry.Description
+		}
+	case "va":
+		line1 = "Value the budget as it stood on a past day, at that day's exchange rates:"
+		line2 = "'value-at <YYYY-MM-DD>' (e.g., 'value-at 2024-12-31')"
+		line3 = "Past rates are kept on disk, so a day only needs fetching once."
+	case "fo":
+		line1 = "Project balances forward using recurring rules and expected items:"
+		line2 = "'forecast <days>' (e.g., 'forecast 90'); add expected items with 'recurring expect'"
+	case "tr":
+		line1 = "Move money between wallets, converting if the currencies differ:"
+		line2 = "'transfer <from> <to> <amount> [fee] [@rate]'"
+		line3 = "(e.g., 'transfer 1 2 100', 'transfer 1 2 100 2.50 @0.92')"
+	case "ho":
+		line1 = "Track investments; the wallet balance follows quantity × price:"
+		line2 = "'holding <index> <symbol> <quantity> [cost basis]' | 'holdings <index>' shows value and gain"
+		line3 = "Prices come from 'price <symbol> <value> [currency]' or prices.csv in the config folder."
+	case "pr":
+		line1 = "Set the price of a symbol and revalue every wallet holding it:"
+		line2 = "'price <symbol> <value> [currency]' (e.g., 'price VWCE 112.30 EUR')"
+		line3 = "Without a currency, the price is in each wallet's own currency."
+	case "ra":
+		line1 = "Fix an exchange rate for this budget, e.g. the one your bank gave you:"
+		line2 = "'rate' lists them | 'rate <FROM> <TO> <rate>' (e.g., 'rate USD ARS 1050') | 'rate clear [FROM TO]'"
+		line3 = "Overrides work both ways and win over market rates; the total marks when one is used."
+	case "li":
+		line1 = "Set the credit limit of a credit card, loan or mortgage:"
+		line2 = "'limit <index> <amount>' (e.g., 'limit 3 5000'); 'limit 3 0' removes it"
+		line3 = "Utilization shows next to the currency; liabilities count against net worth."
+	case "of":
+		line1 = "Convert without fetching exchange rates, using the last cached ones:"
+		line2 = "'offline on' | 'offline off' (or start with --offline)"
+		line3 = "The total shows how old the rates are whenever they're out of date."
+	case "en":
+		line1 = "Encrypt this budget with a passphrase:"
+		line2 = "'encrypt' asks for a passphrase, or changes it if the budget is already encrypted"
 	default:
 		line1 = "Available commands:"
-		line2 = "new |  adjust  |  hide  |  filter  |  currency  |  delete"
+		line2 = "new | edit | adjust | transfer | delete | undo | hide | filter | currency | history | forecast"
 	}
 
 	hints := lipgloss.NewStyle().
@@ -441,9 +689,19 @@ func (m model) createCommandHints() string {
 }
 
 func (m model) walletCreationView() string {
+	titleText := "CREATE NEW WALLET"
+	steps := 5
+	if m.creationPrefilled {
+		titleText = "EDIT WALLET"
+		// The last step only comes up when the currency changes
+		steps = 4
+		if m.creationStep == 4 || m.editedCurrencyChanged() {
+			steps = 5
+		}
+	}
 	title := lipgloss.NewStyle().
 		Bold(true).
-		Render("CREATE NEW WALLET")
+		Render(titleText)
 
 	var content []string
 	content = append(content, title)
@@ -451,7 +709,11 @@ func (m model) walletCreationView() string {
 
 	switch m.creationStep {
 	case 0: // Name input
-		content = append(content, "Step 1 of 5. Name your new wallet")
+		prompt := "Name your new wallet"
+		if m.creationPrefilled {
+			prompt = "Name"
+		}
+		content = append(content, fmt.Sprintf("Step 1 of %d. %s", steps, prompt))
 		content = append(content, "")
 		content = append(content, m.createTextInput())
 
@@ -459,11 +721,11 @@ func (m model) walletCreationView() string {
 		var prompt string
 		switch m.creationStep {
 		case 1:
-			prompt = "Step 2 of 5. What's your wallet type?"
+			prompt = fmt.Sprintf("Step 2 of %d. What's your wallet type?", steps)
 		case 2:
-			prompt = "Step 3 of 5. What currency?"
+			prompt = fmt.Sprintf("Step 3 of %d. What currency?", steps)
 		case 3:
-			prompt = "Step 4 of 5. Who owns this wallet?"
+			prompt = fmt.Sprintf("Step 4 of %d. Who owns this wallet?", steps)
 		}
 
 		content = append(content, prompt)
@@ -472,12 +734,27 @@ func (m model) walletCreationView() string {
 		content = append(content, "")
 		content = append(content, m.createTextInput()) // Always show input
 
-	case 4: // Balance input
-		content = append(content, "Step 5 of 5. Initial balance (or press Enter for 0.00)")
+	case 4: // Balance input, or the conversion choice when editing
+		if m.creationPrefilled {
+			original, _ := m.editedWallet()
+			content = append(content, fmt.Sprintf("Step 5 of 5. The currency changes from %s to %s. What about the balance?", original.Currency, m.creationData.Currency))
+			content = append(content, "")
+			content = append(content, m.createSelectionList())
+			break
+		}
+		zero := m.formatAmount(data.NewMoney(0, 0), m.creationData.Currency)
+		content = append(content, fmt.Sprintf("Step 5 of 5. Initial balance (or press Enter for %s)", zero))
 		content = append(content, "")
 		content = append(content, m.createTextInput())
 	}
 
+	if m.creationError != "" {
+		content = append(content, "")
+		content = append(content, lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF0000")).
+			Render(m.creationError))
+	}
+
 	// Current values display
 	if m.creationStep > 0 {
 		content = append(content, "")
@@ -580,3 +857,90 @@ func (m model) createCreationInstructions() string {
 		Foreground(lipgloss.Color("#626262")).
 		Render(strings.Join(instructions, "  |  "))
 }
+
+// forecastVisibleRows is how many forecast rows fit on screen at once
+const forecastVisibleRows = 15
+
+// forecastRows lists the forecast days on which something happens, plus the
+// last day, one line per event
+func (m model) forecastRows() []string {
+	var rows []string
+	days := m.forecast.Days
+	for i, day := range days {
+		if len(day.Events) == 0 && i != len(days)-1 {
+			continue
+		}
+
+		date := day.Date.Format("2006-01-02")
+		total := m.formatAmount(day.Total, m.forecast.Currency)
+		if len(day.Events) == 0 {
+			rows = append(rows, fmt.Sprintf("%-10s  %-34s %18s", date, "", total))
+			continue
+		}
+		for j, event := range day.Events {
+			what := fmt.Sprintf("%s %s", m.formatSigned(event.Amount, event.Currency), event.Wallet)
+			if event.Expected {
+				what += " (expected)"
+			}
+			if j > 0 {
+				date, total = "", ""
+			}
+			rows = append(rows, fmt.Sprintf("%-10s  %-34s %18s", date, truncate(what, 34), total))
+		}
+	}
+	return rows
+}
+
+func (m model) forecastView() string {
+	days := len(m.forecast.Days)
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Render(fmt.Sprintf("FORECAST FOR THE NEXT %d DAYS", days))
+
+	var status string
+	if m.forecast.FirstNegative.IsZero() {
+		status = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#00AA00")).
+			Render("No wallet goes negative in this period")
+	} else {
+		status = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF0000")).
+			Bold(true).
+			Render(fmt.Sprintf("%s goes negative on %s",
+				m.forecast.FirstNegativeWallet, m.forecast.FirstNegative.Format("2006-01-02")))
+	}
+
+	header := fmt.Sprintf("%-10s  %-34s %18s", "Date", "Change", "Total")
+	separator := strings.Repeat("-", len(header))
+
+	rows := m.forecastRows()
+	if len(rows) == 0 {
+		rows = []string{"No recurring rules or expected items in this period"}
+	}
+	end := min(m.forecastOffset+forecastVisibleRows, len(rows))
+	visible := rows[m.forecastOffset:end]
+
+	var notes []string
+	if len(m.forecast.Unconverted) > 0 {
+		notes = append(notes, "Left out of the total (no exchange rate): "+strings.Join(m.forecast.Unconverted, ", "))
+	}
+	if len(m.forecast.Skipped) > 0 {
+		notes = append(notes, "Not projected (no exchange rate): "+strings.Join(m.forecast.Skipped, ", "))
+	}
+
+	instructions := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("#626262")).
+		Render("Use ↑↓ to scroll  |  Esc to go back")
+
+	content := []string{title, "", status, "", header, separator}
+	content = append(content, visible...)
+	content = append(content, separator)
+	content = append(content, notes...)
+	content = append(content, "", instructions)
+
+	return lipgloss.Place(
+		m.width, m.height,
+		lipgloss.Center, lipgloss.Center,
+		lipgloss.JoinVertical(lipgloss.Left, content...),
+	)
+}